@@ -0,0 +1,214 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderAuthorization     = "Authorization"
+	DefaultTokenExpiryDelta = 10 * time.Second
+)
+
+type (
+	// Authenticator adds credentials to every attempt Client.Do makes, set it with Client.WithAuth
+	// it runs after the RateLimiter wait, right before the request is sent
+	Authenticator interface {
+		Authenticate(req *http.Request) error
+	}
+	// Refresher is optional for an Authenticator, when a response is a 401 Client.Do calls Refresh
+	// with the request which was rejected and then retries it once
+	Refresher interface {
+		Refresh(rejected *http.Request) error
+	}
+
+	// ClientCredentials is an Authenticator and Refresher for the OAuth2 client credentials grant
+	// the token is cached until shortly before it expires and concurrent calls share one fetch
+	ClientCredentials struct {
+		client       Client // calls the token endpoint
+		tokenURL     string
+		clientID     string
+		clientSecret string
+		scopes       []string
+		params       url.Values
+		authInBody   bool
+		expiryDelta  time.Duration
+
+		mu       sync.Mutex
+		token    *Token
+		fetching *tokenFetch
+	}
+	ClientCredentialsOption = func(*ClientCredentials)
+
+	Token struct {
+		AccessToken string    `json:"access_token"`
+		TokenType   string    `json:"token_type,omitempty"`
+		ExpiresIn   int       `json:"expires_in,omitempty"`
+		Expiry      time.Time `json:"-"` // zero when the token does not expire
+	}
+	// TokenError is the error response of a token endpoint, see RFC 6749 section 5.2
+	TokenError struct {
+		Code        string `json:"error"`
+		Description string `json:"error_description,omitempty"`
+		URI         string `json:"error_uri,omitempty"`
+	}
+	tokenFetch struct {
+		done  chan struct{}
+		token *Token
+		err   error
+	}
+)
+
+// NewClientCredentials fetches tokens from tokenURL using client, which gets its own logging,
+// rate limiting and retries, the client id and secret are sent using basic auth
+func NewClientCredentials(client Client, tokenURL, clientID, clientSecret string, options ...ClientCredentialsOption) *ClientCredentials {
+	cc := &ClientCredentials{
+		client:       client.WithStatusErrors(true),
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		params:       url.Values{},
+		expiryDelta:  DefaultTokenExpiryDelta,
+	}
+	for _, option := range options {
+		option(cc)
+	}
+	return cc
+}
+func TokenScopes(scopes ...string) ClientCredentialsOption {
+	return func(cc *ClientCredentials) { cc.scopes = scopes }
+}
+
+// TokenParam adds a parameter to the token request, such as audience
+func TokenParam(k, v string) ClientCredentialsOption {
+	return func(cc *ClientCredentials) { cc.params.Add(k, v) }
+}
+
+// TokenAuthInBody sends the client id and secret as form parameters rather than using basic auth
+func TokenAuthInBody() ClientCredentialsOption {
+	return func(cc *ClientCredentials) { cc.authInBody = true }
+}
+
+// TokenExpiryDelta is how long before it expires a token is refreshed, DefaultTokenExpiryDelta by default
+func TokenExpiryDelta(d time.Duration) ClientCredentialsOption {
+	return func(cc *ClientCredentials) { cc.expiryDelta = d }
+}
+
+func (cc *ClientCredentials) Authenticate(req *http.Request) error {
+	token, err := cc.Token(req.Context())
+	if err != nil {
+		return err
+	}
+	req.Header.Set(HeaderAuthorization, "Bearer "+token.AccessToken)
+	return nil
+}
+
+// Refresh fetches a new token unless one was fetched since the rejected request was sent
+func (cc *ClientCredentials) Refresh(rejected *http.Request) error {
+	cc.mu.Lock()
+	if cc.token != nil && rejected.Header.Get(HeaderAuthorization) == "Bearer "+cc.token.AccessToken {
+		cc.token = nil
+	}
+	cc.mu.Unlock()
+	_, err := cc.Token(rejected.Context())
+	return err
+}
+
+// Token returns the cached token or fetches a new one when it is about to expire
+func (cc *ClientCredentials) Token(ctx context.Context) (Token, error) {
+	cc.mu.Lock()
+	if cc.token != nil && (cc.token.Expiry.IsZero() || time.Until(cc.token.Expiry) > cc.expiryDelta) {
+		token := *cc.token
+		cc.mu.Unlock()
+		return token, nil
+	}
+	f := cc.fetching
+	if f == nil {
+		f = &tokenFetch{done: make(chan struct{})}
+		cc.fetching = f
+		// not canceled with ctx, since other callers may be waiting on it too
+		go cc.fetch(context.WithoutCancel(ctx), f)
+	}
+	cc.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return Token{}, ctx.Err()
+	case <-f.done:
+	}
+	if f.err != nil {
+		return Token{}, f.err
+	}
+	return *f.token, nil
+}
+func (cc *ClientCredentials) fetch(ctx context.Context, f *tokenFetch) {
+	f.token, f.err = cc.fetchToken(ctx)
+	cc.mu.Lock()
+	if f.err == nil {
+		cc.token = f.token
+	}
+	cc.fetching = nil
+	cc.mu.Unlock()
+	close(f.done)
+}
+func (cc *ClientCredentials) fetchToken(ctx context.Context) (*Token, error) {
+	form := url.Values{"grant_type": {"client_credentials"}}
+	for k, v := range cc.params {
+		form[k] = v
+	}
+	if len(cc.scopes) > 0 {
+		form.Set("scope", strings.Join(cc.scopes, " "))
+	}
+	header := http.Header{HeaderContentType: {ApplicationForm}}
+	if cc.authInBody {
+		form.Set("client_id", cc.clientID)
+		form.Set("client_secret", cc.clientSecret)
+	}
+	req, err := cc.client.Request(ctx, http.MethodPost, cc.tokenURL, header, form)
+	if err != nil {
+		return nil, err
+	}
+	if !cc.authInBody {
+		req.SetBasicAuth(url.QueryEscape(cc.clientID), url.QueryEscape(cc.clientSecret))
+	}
+	var (
+		token    Token
+		tokenErr TokenError
+	)
+	if _, err := cc.client.DoAndDecode(req, &token, &tokenErr); err != nil {
+		return nil, fmt.Errorf("%s: %w", "fetch token failed", err)
+	}
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("%s: %s", "fetch token failed", "no access_token in response")
+	}
+	if token.ExpiresIn > 0 {
+		token.Expiry = time.Now().Add(time.Duration(token.ExpiresIn) * time.Second)
+	}
+	return &token, nil
+}
+
+func (e TokenError) Error() string {
+	if e.Description != "" {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+// unauthorized reports if res is a 401 which the Auth may fix by refreshing its credentials
+func (c Client) unauthorized(res *http.Response) bool {
+	_, ok := c.Auth.(Refresher)
+	return ok && res != nil && res.StatusCode == http.StatusUnauthorized
+}
+
+// rejectedRequest is the request as it was sent, with the credentials the Auth added
+func rejectedRequest(req *http.Request, res *http.Response) *http.Request {
+	if res.Request != nil {
+		return res.Request.WithContext(req.Context())
+	}
+	return req
+}
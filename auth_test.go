@@ -0,0 +1,201 @@
+package httputil_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_WithAuth_clientCredentials(t *testing.T) {
+	type tokenServer struct {
+		fetches atomic.Int32
+		valid   atomic.Value // the access token the api accepts
+		client  httputil.Client
+	}
+	newServer := func(t *testing.T, expiresIn int) *tokenServer {
+		ts := &tokenServer{}
+		ts.valid.Store("token-1")
+		ts.client = clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/oauth/token" {
+				n := ts.fetches.Add(1)
+				time.Sleep(10 * time.Millisecond) // so concurrent calls overlap
+				id, secret, _ := r.BasicAuth()
+				if !assert.NoError(t, r.ParseForm()) {
+					return
+				}
+				assert.Equal(t, "client_credentials", r.PostForm.Get("grant_type"))
+				assert.Equal(t, "read write", r.PostForm.Get("scope"))
+				if id != "id" || secret != "s3cr3t" {
+					w.WriteHeader(http.StatusUnauthorized)
+					writeJSON(w, map[string]string{"error": "invalid_client"})
+					return
+				}
+				writeJSON(w, map[string]any{
+					"access_token": fmt.Sprintf("token-%d", n),
+					"token_type":   "Bearer",
+					"expires_in":   expiresIn,
+				})
+				return
+			}
+			if r.Header.Get("Authorization") != "Bearer "+ts.valid.Load().(string) {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			writeJSON(w, ResModel{ID: "1"})
+		})
+		return ts
+	}
+	get := func(t *testing.T, client httputil.Client) (*http.Response, error) {
+		req, err := client.Request(ctx, http.MethodGet, "/ref", nil, nil)
+		require.NoError(t, err)
+		return client.Do(req)
+	}
+	auth := func(ts *tokenServer, secret string, options ...httputil.ClientCredentialsOption) *httputil.ClientCredentials {
+		options = append(options, httputil.TokenScopes("read", "write"))
+		return httputil.NewClientCredentials(ts.client, ts.client.Host+"/oauth/token", "id", secret, options...)
+	}
+
+	t.Run("cached", func(t *testing.T) {
+		ts := newServer(t, 3600)
+		client := ts.client.WithAuth(auth(ts, "s3cr3t"))
+		for i := 0; i < 3; i++ {
+			res, err := get(t, client)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+		assert.Equal(t, int32(1), ts.fetches.Load())
+	})
+	t.Run("single flight", func(t *testing.T) {
+		var (
+			ts     = newServer(t, 3600)
+			client = ts.client.WithAuth(auth(ts, "s3cr3t"))
+			wg     sync.WaitGroup
+		)
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				res, err := get(t, client)
+				if assert.NoError(t, err) {
+					assert.Equal(t, http.StatusOK, res.StatusCode)
+				}
+			}()
+		}
+		wg.Wait()
+		assert.Equal(t, int32(1), ts.fetches.Load())
+	})
+	t.Run("refreshed before expiry", func(t *testing.T) {
+		ts := newServer(t, 1)
+		client := ts.client.WithAuth(auth(ts, "s3cr3t", httputil.TokenExpiryDelta(time.Second)))
+		for i := 1; i <= 2; i++ {
+			ts.valid.Store(fmt.Sprintf("token-%d", i))
+			res, err := get(t, client)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+		assert.Equal(t, int32(2), ts.fetches.Load())
+	})
+	t.Run("refresh once on 401", func(t *testing.T) {
+		ts := newServer(t, 3600)
+		client := ts.client.WithAuth(auth(ts, "s3cr3t"))
+		_, err := get(t, client)
+		require.NoError(t, err)
+
+		// the token was revoked
+		ts.valid.Store("token-2")
+		res, err := get(t, client)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int32(2), ts.fetches.Load())
+
+		// rejected again after the refresh, so it gives up
+		ts.valid.Store("none")
+		res, err = get(t, client)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+		assert.Equal(t, int32(3), ts.fetches.Load())
+	})
+	t.Run("token error", func(t *testing.T) {
+		ts := newServer(t, 3600)
+		client := ts.client.WithAuth(auth(ts, "wrong"))
+		_, err := get(t, client)
+		var tokenErr *httputil.TokenError
+		require.True(t, errors.As(err, &tokenErr), err)
+		assert.Equal(t, "invalid_client", tokenErr.Code)
+		assert.ErrorIs(t, err, httputil.ErrUnauthorized)
+	})
+}
+func TestClient_WithAuth_timing(t *testing.T) {
+	var (
+		buf    bytes.Buffer
+		logger = slog.New(slog.NewJSONHandler(&buf, nil))
+		delay  = 100 * time.Millisecond
+	)
+	client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}).
+		WithLogger(logger).
+		WithAuth(slowAuth(delay))
+
+	req, err := client.Request(ctx, http.MethodGet, "/ref", nil, nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.NoError(t, err)
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Less(t, lines[0]["rateLimitWait"], float64(delay), "authenticating is not waiting on the rate limiter")
+}
+
+func TestClient_WithAuth_refreshAndRetry(t *testing.T) {
+	var (
+		callCtr atomic.Int32
+		auth    = &refreshCounter{}
+		client  = clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			switch n := callCtr.Add(1); {
+			case n == 1:
+				w.WriteHeader(http.StatusUnauthorized)
+			case n <= 3:
+				w.WriteHeader(http.StatusServiceUnavailable)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+		}).
+			WithAuth(auth).
+			WithRetryPolicy(httputil.NewRetryPolicy(2, httputil.RetryDelay(0, 0)))
+	)
+	req, err := client.Request(ctx, http.MethodGet, "/ref", nil, nil)
+	require.NoError(t, err)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode, "both 503 retries are left after the refresh")
+	assert.Equal(t, int32(4), callCtr.Load())
+	assert.Equal(t, int32(1), auth.refreshes.Load())
+}
+
+// refreshCounter is a Refresher which counts its refreshes
+type refreshCounter struct{ refreshes atomic.Int32 }
+
+func (a *refreshCounter) Authenticate(*http.Request) error { return nil }
+func (a *refreshCounter) Refresh(*http.Request) error {
+	a.refreshes.Add(1)
+	return nil
+}
+
+// slowAuth is an Authenticator which takes d, like a token fetch
+type slowAuth time.Duration
+
+func (d slowAuth) Authenticate(*http.Request) error {
+	time.Sleep(time.Duration(d))
+	return nil
+}
@@ -0,0 +1,105 @@
+package httputil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrBodyNotReplayable = errors.New("request body can not be replayed")
+)
+
+// replayableBody returns the body for http.NewRequest and the GetBody which replays it
+// bytes and strings readers are replayed by http.NewRequest itself so getBody is nil for them
+// an io.Seeker is rewound to the offset it had, it is not closed since the caller owns it
+// any other reader is kept in memory as it is sent and closed once it has been read to the end
+func replayableBody(r io.Reader) (io.Reader, func() (io.ReadCloser, error)) {
+	switch r.(type) {
+	case *bytes.Buffer, *bytes.Reader, *strings.Reader:
+		return r, nil
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		if offset, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			return io.NopCloser(r), func() (io.ReadCloser, error) {
+				if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+					return nil, err
+				}
+				return io.NopCloser(r), nil
+			}
+		}
+	}
+	t := &teeBody{r: r}
+	return t.reader(), func() (io.ReadCloser, error) { return t.reader(), nil }
+}
+
+// teeBody keeps what has been read from r so every reader of it starts from the beginning
+// r is only read as far as the furthest reader got, so a pipe can still be written to after Request
+type teeBody struct {
+	mu  sync.Mutex
+	r   io.Reader
+	buf []byte
+	err error
+}
+
+func (t *teeBody) reader() io.ReadCloser {
+	return io.NopCloser(&teeReader{t: t})
+}
+
+// readAt copies from the kept bytes at offset, reading more from r once those run out
+func (t *teeBody) readAt(p []byte, offset int) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if offset < len(t.buf) {
+		return copy(p, t.buf[offset:]), nil
+	}
+	if t.err != nil {
+		return 0, t.err
+	}
+	n, err := t.r.Read(p)
+	t.buf = append(t.buf, p[:n]...)
+	if err == nil {
+		return n, nil
+	}
+	if c, ok := t.r.(io.Closer); ok {
+		_ = c.Close()
+	}
+	if err != io.EOF {
+		err = fmt.Errorf("%s: %w", "read body failed", err)
+	}
+	t.err = err
+	return n, err
+}
+
+type teeReader struct {
+	t      *teeBody
+	offset int
+}
+
+func (r *teeReader) Read(p []byte) (int, error) {
+	n, err := r.t.readAt(p, r.offset)
+	r.offset += n
+	return n, err
+}
+
+// rewindBody returns a copy of req with a fresh body from req.GetBody, or a plain copy when it has no body
+// the first attempt used up the original body so every retry needs its own
+func rewindBody(req *http.Request) (*http.Request, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return req.Clone(req.Context()), nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("%w: %s %s has no GetBody", ErrBodyNotReplayable, req.Method, req.URL)
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBodyNotReplayable, err)
+	}
+	req = req.Clone(req.Context())
+	req.Body = body
+	return req, nil
+}
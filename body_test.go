@@ -0,0 +1,109 @@
+package httputil_test
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_RetryReplaysBody(t *testing.T) {
+	var (
+		retries = 2
+		payload = `{"name":"Robert"}`
+	)
+	newClient := func(t *testing.T, bodies *[]string) httputil.Client {
+		var callCtr = atomic.Int32{}
+		return clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			*bodies = append(*bodies, string(b))
+			if callCtr.Add(1) <= int32(retries) {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}).With429Retry(retries)
+	}
+	t.Run("json body", func(t *testing.T) {
+		var (
+			bodies []string
+			client = newClient(t, &bodies)
+		)
+		req, err := client.Request(ctx, http.MethodPost, "/", nil, ReqModel{Name: "Robert"})
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, []string{payload, payload, payload}, bodies)
+	})
+	t.Run("io.Reader body", func(t *testing.T) {
+		var (
+			bodies []string
+			client = newClient(t, &bodies)
+			body   = io.MultiReader(strings.NewReader(payload)) // not a type http.NewRequest can replay
+		)
+		req, err := client.Request(ctx, http.MethodPut, "/", nil, body)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, []string{payload, payload, payload}, bodies)
+	})
+	t.Run("file body", func(t *testing.T) {
+		var (
+			bodies []string
+			client = newClient(t, &bodies)
+			path   = filepath.Join(t.TempDir(), "body.json")
+		)
+		require.NoError(t, os.WriteFile(path, []byte("skip"+payload), 0o600))
+		f, err := os.Open(path)
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = f.Seek(4, io.SeekStart)
+		require.NoError(t, err)
+
+		req, err := client.Request(ctx, http.MethodPut, "/", nil, f)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, []string{payload, payload, payload}, bodies, "rewound to where it was")
+	})
+	t.Run("pipe written after Request", func(t *testing.T) {
+		var (
+			bodies []string
+			client = newClient(t, &bodies)
+			pr, pw = io.Pipe()
+		)
+		req, err := client.Request(ctx, http.MethodPut, "/", nil, pr)
+		require.NoError(t, err)
+		go func() {
+			_, _ = io.WriteString(pw, payload)
+			_ = pw.Close()
+		}()
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, []string{payload, payload, payload}, bodies)
+	})
+	t.Run("not replayable", func(t *testing.T) {
+		var (
+			bodies []string
+			client = newClient(t, &bodies)
+			body   = io.MultiReader(strings.NewReader(payload))
+		)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.Host, body)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		assert.ErrorIs(t, err, httputil.ErrBodyNotReplayable)
+		assert.Nil(t, res)
+		assert.Equal(t, []string{payload}, bodies)
+	})
+}
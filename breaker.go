@@ -0,0 +1,245 @@
+package httputil
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	CircuitState int
+
+	// CircuitBreaker keeps a circuit per host, Client.Do checks it before waiting on the
+	// RateLimiter so calls to a host which is down fail fast with ErrCircuitOpen
+	// a circuit opens when the failure ratio over the rolling window reaches the threshold,
+	// after the cooldown it is half-open and lets probe calls through, if they all succeed it
+	// closes again and if any fails it opens again
+	// a nil CircuitBreaker lets every call through, clones of the client see the same circuit for a host
+	CircuitBreaker struct {
+		failureRatio   float64
+		minRequests    int
+		window         time.Duration
+		cooldown       time.Duration
+		halfOpenProbes int
+		isFailure      func(res *http.Response, err error) bool
+		onStateChange  func(host string, from, to CircuitState)
+
+		mu       sync.Mutex
+		circuits map[string]*circuit
+	}
+	CircuitOption = func(*CircuitBreaker)
+
+	circuit struct {
+		state    CircuitState
+		openedAt time.Time
+		buckets  []circuitBucket
+		probes   int // half-open calls in flight
+		passed   int // half-open calls which succeeded
+	}
+	circuitBucket struct {
+		start     time.Time
+		successes int
+		failures  int
+	}
+)
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+const (
+	DefaultCircuitFailureRatio = 0.5
+	DefaultCircuitMinRequests  = 10
+	DefaultCircuitWindow       = time.Minute
+	DefaultCircuitCooldown     = 30 * time.Second
+	circuitBuckets             = 10
+)
+
+var (
+	ErrCircuitOpen = errors.New("circuit breaker open")
+)
+
+func NewCircuitBreaker(options ...CircuitOption) *CircuitBreaker {
+	b := &CircuitBreaker{
+		failureRatio:   DefaultCircuitFailureRatio,
+		minRequests:    DefaultCircuitMinRequests,
+		window:         DefaultCircuitWindow,
+		cooldown:       DefaultCircuitCooldown,
+		halfOpenProbes: 1,
+		isFailure:      isCircuitFailure,
+		circuits:       make(map[string]*circuit),
+	}
+	for _, option := range options {
+		option(b)
+	}
+	return b
+}
+
+// CircuitFailureRatio opens the circuit when at least minRequests were made in the window
+// and the ratio of them which failed is >= ratio
+func CircuitFailureRatio(ratio float64, minRequests int) CircuitOption {
+	return func(b *CircuitBreaker) { b.failureRatio, b.minRequests = ratio, minRequests }
+}
+func CircuitWindow(d time.Duration) CircuitOption {
+	return func(b *CircuitBreaker) { b.window = d }
+}
+func CircuitCooldown(d time.Duration) CircuitOption {
+	return func(b *CircuitBreaker) { b.cooldown = d }
+}
+func CircuitHalfOpenProbes(n int) CircuitOption {
+	return func(b *CircuitBreaker) { b.halfOpenProbes = max(n, 1) }
+}
+
+// CircuitIsFailure replaces the default which counts transport errors and status >= 500
+func CircuitIsFailure(fn func(res *http.Response, err error) bool) CircuitOption {
+	return func(b *CircuitBreaker) { b.isFailure = fn }
+}
+func CircuitOnStateChange(fn func(host string, from, to CircuitState)) CircuitOption {
+	return func(b *CircuitBreaker) { b.onStateChange = fn }
+}
+
+// Allow returns ErrCircuitOpen when calls to host should not be made
+// every call which is allowed must be followed by a call to Done
+func (b *CircuitBreaker) Allow(host string) error {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	c := b.circuit(host)
+	from := c.state
+	if c.state == CircuitOpen && time.Now().Sub(c.openedAt) >= b.cooldown {
+		c.state, c.probes, c.passed = CircuitHalfOpen, 0, 0
+	}
+	var err error
+	switch {
+	case c.state == CircuitOpen:
+		err = fmt.Errorf("%w: %s", ErrCircuitOpen, host)
+	case c.state == CircuitHalfOpen && c.probes >= b.halfOpenProbes:
+		err = fmt.Errorf("%w: %s half-open", ErrCircuitOpen, host)
+	case c.state == CircuitHalfOpen:
+		c.probes++
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	b.changed(host, from, to)
+	return err
+}
+
+// Done records the outcome of a call which Allow let through
+// pass a nil res and nil err when the call was never made, such as when the context was canceled
+func (b *CircuitBreaker) Done(host string, res *http.Response, err error) {
+	if b == nil {
+		return
+	}
+	var (
+		attempted = res != nil || err != nil
+		failed    = attempted && b.isFailure(res, err)
+	)
+	b.mu.Lock()
+	var (
+		c    = b.circuit(host)
+		from = c.state
+		now  = time.Now()
+	)
+	switch c.state {
+	case CircuitHalfOpen:
+		c.probes = max(c.probes-1, 0)
+		switch {
+		case failed:
+			c.open(now)
+		case attempted:
+			c.passed++
+			if c.passed >= b.halfOpenProbes {
+				c.state, c.buckets = CircuitClosed, nil
+			}
+		}
+	case CircuitClosed:
+		if attempted {
+			c.record(now, b.window, failed)
+			if total, failures := c.counts(now, b.window); total >= b.minRequests &&
+				float64(failures)/float64(total) >= b.failureRatio {
+				c.open(now)
+			}
+		}
+	}
+	to := c.state
+	b.mu.Unlock()
+
+	b.changed(host, from, to)
+}
+func (b *CircuitBreaker) State(host string) CircuitState {
+	if b == nil {
+		return CircuitClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	c := b.circuit(host)
+	if c.state == CircuitOpen && time.Now().Sub(c.openedAt) >= b.cooldown {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
+
+func (b *CircuitBreaker) circuit(host string) *circuit {
+	c, ok := b.circuits[host]
+	if !ok {
+		c = &circuit{}
+		b.circuits[host] = c
+	}
+	return c
+}
+func (b *CircuitBreaker) changed(host string, from, to CircuitState) {
+	if from != to && b.onStateChange != nil {
+		b.onStateChange(host, from, to)
+	}
+}
+
+func (c *circuit) open(now time.Time) {
+	c.state, c.openedAt, c.buckets, c.probes, c.passed = CircuitOpen, now, nil, 0, 0
+}
+
+// record counts the outcome in the current bucket, each bucket is window/circuitBuckets long
+func (c *circuit) record(now time.Time, window time.Duration, failed bool) {
+	width := window / circuitBuckets
+	if n := len(c.buckets); n == 0 || now.Sub(c.buckets[n-1].start) >= width {
+		c.buckets = append(c.buckets, circuitBucket{start: now})
+	}
+	last := &c.buckets[len(c.buckets)-1]
+	if failed {
+		last.failures++
+	} else {
+		last.successes++
+	}
+}
+
+// counts drops buckets which have rolled out of the window and sums the rest
+func (c *circuit) counts(now time.Time, window time.Duration) (total, failures int) {
+	for len(c.buckets) > 0 && now.Sub(c.buckets[0].start) >= window {
+		c.buckets = c.buckets[1:]
+	}
+	for _, bucket := range c.buckets {
+		total += bucket.successes + bucket.failures
+		failures += bucket.failures
+	}
+	return total, failures
+}
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("CircuitState(%d)", int(s))
+}
+func isCircuitFailure(res *http.Response, err error) bool {
+	return err != nil || (res != nil && res.StatusCode >= 500)
+}
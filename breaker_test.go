@@ -0,0 +1,142 @@
+package httputil_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_WithCircuitBreaker(t *testing.T) {
+	var (
+		cooldown = 50 * time.Millisecond
+		callCtr  atomic.Int32
+		healthy  atomic.Bool
+		mu       sync.Mutex
+		changes  []string
+		breaker  = httputil.NewCircuitBreaker(
+			httputil.CircuitFailureRatio(0.5, 2),
+			httputil.CircuitCooldown(cooldown),
+			httputil.CircuitOnStateChange(func(host string, from, to httputil.CircuitState) {
+				mu.Lock()
+				defer mu.Unlock()
+				changes = append(changes, from.String()+">"+to.String())
+			}),
+		)
+	)
+	client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		callCtr.Add(1)
+		if healthy.Load() {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}).WithCircuitBreaker(breaker)
+	clone := client.Clone()
+	do := func(ctx context.Context) (*http.Response, error) {
+		req, err := clone.Request(ctx, http.MethodGet, "/", nil, nil)
+		require.NoError(t, err)
+		return clone.Do(req)
+	}
+
+	// two failures open the circuit
+	for i := 0; i < 2; i++ {
+		res, err := do(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusInternalServerError, res.StatusCode)
+	}
+	assert.Equal(t, httputil.CircuitOpen, breaker.State(hostOf(client)))
+
+	// fail fast, before the rate limiter would return the context error
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err := do(canceled)
+	assert.ErrorIs(t, err, httputil.ErrCircuitOpen)
+	assert.Equal(t, int32(2), callCtr.Load())
+
+	// after the cooldown a probe is let through and closes it again
+	time.Sleep(cooldown)
+	healthy.Store(true)
+	res, err := do(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, httputil.CircuitClosed, breaker.State(hostOf(client)))
+	assert.Equal(t, int32(3), callCtr.Load())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"closed>open", "open>half-open", "half-open>closed"}, changes)
+}
+func TestCircuitBreaker(t *testing.T) {
+	var (
+		serverErr = &http.Response{StatusCode: http.StatusBadGateway}
+		ok        = &http.Response{StatusCode: http.StatusOK}
+		fail      = errors.New("dial failed")
+	)
+	t.Run("per host", func(t *testing.T) {
+		b := httputil.NewCircuitBreaker(httputil.CircuitFailureRatio(1, 1))
+		require.NoError(t, b.Allow("a"))
+		b.Done("a", nil, fail)
+		assert.ErrorIs(t, b.Allow("a"), httputil.ErrCircuitOpen)
+		assert.NoError(t, b.Allow("b"))
+	})
+	t.Run("ratio", func(t *testing.T) {
+		b := httputil.NewCircuitBreaker(httputil.CircuitFailureRatio(0.5, 4))
+		for _, res := range []*http.Response{ok, ok, serverErr} {
+			require.NoError(t, b.Allow("a"))
+			b.Done("a", res, nil)
+		}
+		assert.Equal(t, httputil.CircuitClosed, b.State("a"), "below min requests")
+		require.NoError(t, b.Allow("a"))
+		b.Done("a", ok, nil)
+		assert.Equal(t, httputil.CircuitClosed, b.State("a"), "1 of 4 failed")
+		for i := 0; i < 2; i++ {
+			require.NoError(t, b.Allow("a"))
+			b.Done("a", serverErr, nil)
+		}
+		assert.Equal(t, httputil.CircuitOpen, b.State("a"), "3 of 6 failed")
+	})
+	t.Run("rolling window", func(t *testing.T) {
+		var (
+			window = 50 * time.Millisecond
+			b      = httputil.NewCircuitBreaker(httputil.CircuitFailureRatio(0.5, 2), httputil.CircuitWindow(window))
+		)
+		require.NoError(t, b.Allow("a"))
+		b.Done("a", serverErr, nil)
+		time.Sleep(window)
+		require.NoError(t, b.Allow("a"))
+		b.Done("a", serverErr, nil)
+		assert.Equal(t, httputil.CircuitClosed, b.State("a"), "first failure rolled out of the window")
+	})
+	t.Run("half-open failure reopens", func(t *testing.T) {
+		var (
+			cooldown = 20 * time.Millisecond
+			b        = httputil.NewCircuitBreaker(httputil.CircuitFailureRatio(1, 1), httputil.CircuitCooldown(cooldown))
+		)
+		require.NoError(t, b.Allow("a"))
+		b.Done("a", serverErr, nil)
+		time.Sleep(cooldown)
+		require.NoError(t, b.Allow("a"))
+		assert.ErrorIs(t, b.Allow("a"), httputil.ErrCircuitOpen, "only one probe at a time")
+		b.Done("a", nil, fail)
+		assert.Equal(t, httputil.CircuitOpen, b.State("a"))
+	})
+	t.Run("nil safe", func(t *testing.T) {
+		var b *httputil.CircuitBreaker
+		assert.NoError(t, b.Allow("a"))
+		b.Done("a", nil, fail)
+		assert.Equal(t, httputil.CircuitClosed, b.State("a"))
+	})
+}
+
+func hostOf(c httputil.Client) string {
+	req, _ := c.Request(ctx, http.MethodGet, "/", nil, nil)
+	return req.URL.Host
+}
@@ -0,0 +1,341 @@
+package httputil
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	HeaderCacheControl    = "Cache-Control"
+	HeaderETag            = "ETag"
+	HeaderLastModified    = "Last-Modified"
+	HeaderIfNoneMatch     = "If-None-Match"
+	HeaderIfModifiedSince = "If-Modified-Since"
+	HeaderXCache          = "X-Cache"
+	CacheHit              = "HIT"         // served from the cache without a request
+	CacheRevalidated      = "REVALIDATED" // served from the cache after a 304
+)
+
+type (
+	// Cache is an opt-in private cache for GET responses, set it with Client.WithCache
+	// it respects Cache-Control max-age, no-cache and no-store, Expires and Vary
+	// and revalidates stale responses using If-None-Match and If-Modified-Since
+	// responses served from the cache have the X-Cache header set to HIT or REVALIDATED
+	// a nil Cache sends every request, clones of the client read and write the same entries
+	// so entries are keyed on the credential headers, DefaultRedactHeaders and Client.Redaction.Headers,
+	// but not on what Client.Auth adds, do not share a Cache between clients with a different Auth identity
+	Cache struct {
+		Store CacheStore
+	}
+	// CacheStore holds encoded responses by key, LRUCache and FileCache are built in
+	CacheStore interface {
+		Get(key string) ([]byte, bool)
+		Set(key string, value []byte)
+		Delete(key string)
+	}
+	cacheEntry struct {
+		StoredAt time.Time   `json:"storedAt"`
+		Status   int         `json:"status"`
+		Header   http.Header `json:"header"`
+		Body     []byte      `json:"body"`
+		Vary     http.Header `json:"vary,omitempty"` // request header values the response varies on
+	}
+)
+
+func NewCache(store CacheStore) *Cache {
+	return &Cache{Store: store}
+}
+
+// lookup returns the entry stored for req, if any, and if it can be used without revalidation
+func (c *Cache) lookup(req *http.Request, key string) (*cacheEntry, bool) {
+	if c == nil || c.Store == nil || req.Method != http.MethodGet {
+		return nil, false
+	}
+	reqCC := cacheControl(req.Header)
+	if _, ok := reqCC["no-store"]; ok {
+		return nil, false
+	}
+	b, ok := c.Store.Get(key)
+	if !ok {
+		return nil, false
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil || !e.varyMatches(req) {
+		return nil, false
+	}
+	_, noCache := reqCC["no-cache"]
+	return &e, !noCache && time.Since(e.StoredAt) < e.lifetime()
+}
+
+// revalidate adds the validators of e to req unless the caller already set their own
+func (c *Cache) revalidate(req *http.Request, e *cacheEntry) bool {
+	if e == nil || req.Header.Get(HeaderIfNoneMatch) != "" || req.Header.Get(HeaderIfModifiedSince) != "" {
+		return false
+	}
+	etag, lastMod := e.Header.Get(HeaderETag), e.Header.Get(HeaderLastModified)
+	if etag != "" {
+		req.Header.Set(HeaderIfNoneMatch, etag)
+	}
+	if lastMod != "" {
+		req.Header.Set(HeaderIfModifiedSince, lastMod)
+	}
+	return etag != "" || lastMod != ""
+}
+
+// update stores res when it is cacheable, and when it is a 304 for a revalidation
+// this cache made, it returns the stored response with the headers of the 304 merged in
+func (c *Cache) update(req *http.Request, key string, res *http.Response, e *cacheEntry, revalidating bool) *http.Response {
+	if c == nil || c.Store == nil || req.Method != http.MethodGet || res == nil {
+		return res
+	}
+	if revalidating && res.StatusCode == http.StatusNotModified {
+		for k, v := range res.Header {
+			e.Header[k] = v
+		}
+		e.StoredAt = time.Now()
+		c.set(key, e)
+		discard(res)
+		return e.response(req, CacheRevalidated)
+	}
+	if _, noStore := cacheControl(res.Header)["no-store"]; noStore || res.Header.Get("Vary") == "*" {
+		c.Store.Delete(key)
+		return res
+	}
+	if res.StatusCode != http.StatusOK {
+		return res
+	}
+	entry := &cacheEntry{
+		StoredAt: time.Now(),
+		Status:   res.StatusCode,
+		Header:   res.Header.Clone(),
+		Vary:     varyHeader(req, res),
+	}
+	// only read the body once it is known to be stored, so a large uncacheable download is left streaming
+	if entry.lifetime() <= 0 && entry.Header.Get(HeaderETag) == "" && entry.Header.Get(HeaderLastModified) == "" {
+		return res
+	}
+	body, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return res
+	}
+	entry.Body = body
+	c.set(key, entry)
+	return res
+}
+func (c *Cache) set(key string, e *cacheEntry) {
+	if b, err := json.Marshal(e); err == nil {
+		c.Store.Set(key, b)
+	}
+}
+
+// lifetime is how long the entry is fresh for, from max-age or else Expires
+func (e cacheEntry) lifetime() time.Duration {
+	cc := cacheControl(e.Header)
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	age, _ := strconv.Atoi(e.Header.Get("Age"))
+	if v, ok := cc["max-age"]; ok {
+		secs, err := strconv.Atoi(v)
+		if err != nil {
+			return 0
+		}
+		return time.Duration(secs-age) * time.Second
+	}
+	if expires, err := http.ParseTime(e.Header.Get("Expires")); err == nil {
+		date, err := http.ParseTime(e.Header.Get("Date"))
+		if err != nil {
+			date = e.StoredAt
+		}
+		return expires.Sub(date)
+	}
+	return 0
+}
+func (e cacheEntry) varyMatches(req *http.Request) bool {
+	for k, v := range e.Vary {
+		if strings.Join(req.Header.Values(k), ",") != strings.Join(v, ",") {
+			return false
+		}
+	}
+	return true
+}
+func (e cacheEntry) response(req *http.Request, xCache string) *http.Response {
+	h := e.Header.Clone()
+	h.Set(HeaderXCache, xCache)
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// cacheKey is the method and url, plus a hash of the credential headers so clones of a client
+// with different API keys or cookies do not share entries, credentials is Redaction.Headers
+// it is taken before Authenticate runs, so credentials added by Client.Auth are not part of it
+func cacheKey(req *http.Request, credentials []string) string {
+	key := req.Method + " " + req.URL.String()
+	var names []string
+	for k := range req.Header {
+		if redacts(k, DefaultRedactHeaders, credentials) {
+			names = append(names, k)
+		}
+	}
+	if len(names) == 0 {
+		return key
+	}
+	slices.Sort(names)
+	h := sha256.New()
+	for _, k := range names {
+		fmt.Fprintf(h, "%s:%s\n", strings.ToLower(k), strings.Join(req.Header.Values(k), ","))
+	}
+	return key + " " + hex.EncodeToString(h.Sum(nil))
+}
+func varyHeader(req *http.Request, res *http.Response) http.Header {
+	var vary http.Header
+	for _, v := range res.Header.Values("Vary") {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k == "" {
+				continue
+			}
+			if vary == nil {
+				vary = make(http.Header)
+			}
+			vary[http.CanonicalHeaderKey(k)] = req.Header.Values(k)
+		}
+	}
+	return vary
+}
+
+// cacheControl parses the Cache-Control directives into a map of lowercase name to value
+func cacheControl(h http.Header) map[string]string {
+	cc := make(map[string]string)
+	for _, v := range h.Values(HeaderCacheControl) {
+		for _, directive := range strings.Split(v, ",") {
+			k, val, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			if k != "" {
+				cc[strings.ToLower(k)] = strings.Trim(val, `"`)
+			}
+		}
+	}
+	return cc
+}
+
+// LRUCache is an in memory CacheStore which evicts the least recently used entry
+// once it holds more than capacity entries
+type LRUCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+type lruItem struct {
+	key   string
+	value []byte
+}
+
+func NewLRUCache(capacity int) *LRUCache {
+	return &LRUCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+func (l *LRUCache) Get(key string) ([]byte, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	el, ok := l.items[key]
+	if !ok {
+		return nil, false
+	}
+	l.ll.MoveToFront(el)
+	return el.Value.(*lruItem).value, true
+}
+func (l *LRUCache) Set(key string, value []byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		el.Value.(*lruItem).value = value
+		l.ll.MoveToFront(el)
+		return
+	}
+	l.items[key] = l.ll.PushFront(&lruItem{key: key, value: value})
+	for l.capacity > 0 && l.ll.Len() > l.capacity {
+		oldest := l.ll.Back()
+		l.ll.Remove(oldest)
+		delete(l.items, oldest.Value.(*lruItem).key)
+	}
+}
+func (l *LRUCache) Delete(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if el, ok := l.items[key]; ok {
+		l.ll.Remove(el)
+		delete(l.items, key)
+	}
+}
+func (l *LRUCache) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.ll.Len()
+}
+
+// FileCache is a CacheStore keeping one file per entry in Dir
+// the file name is the sha256 of the key
+type FileCache struct {
+	Dir string
+}
+
+func NewFileCache(dir string) FileCache {
+	return FileCache{Dir: dir}
+}
+func (f FileCache) Get(key string) ([]byte, bool) {
+	b, err := os.ReadFile(f.path(key))
+	return b, err == nil
+}
+func (f FileCache) Set(key string, value []byte) {
+	if err := os.MkdirAll(f.Dir, 0o700); err != nil {
+		return
+	}
+	tmp, err := os.CreateTemp(f.Dir, "tmp-*")
+	if err != nil {
+		return
+	}
+	_, err = tmp.Write(value)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.path(key))
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+}
+func (f FileCache) Delete(key string) {
+	_ = os.Remove(f.path(key))
+}
+func (f FileCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(f.Dir, hex.EncodeToString(sum[:]))
+}
@@ -0,0 +1,168 @@
+package httputil_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_WithCache(t *testing.T) {
+	get := func(t *testing.T, client httputil.Client, path string) (*http.Response, string) {
+		t.Helper()
+		req, err := client.Request(ctx, http.MethodGet, path, nil, nil)
+		require.NoError(t, err)
+		var out ResModel
+		res, err := client.DoAndDecode(req, &out, nil)
+		require.NoError(t, err)
+		b, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(b)
+	}
+	stores := map[string]func(t *testing.T) httputil.CacheStore{
+		"lru":  func(t *testing.T) httputil.CacheStore { return httputil.NewLRUCache(10) },
+		"file": func(t *testing.T) httputil.CacheStore { return httputil.NewFileCache(t.TempDir()) },
+	}
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			t.Run("max-age", func(t *testing.T) {
+				var callCtr atomic.Int32
+				client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+					n := callCtr.Add(1)
+					w.Header().Set(httputil.HeaderCacheControl, "public, max-age=60")
+					writeJSON(w, ResModel{ID: fmt.Sprint(n)})
+				}).WithCache(httputil.NewCache(newStore(t)))
+
+				res1, body1 := get(t, client, "/ref")
+				res2, body2 := get(t, client, "/ref")
+				assert.Equal(t, int32(1), callCtr.Load())
+				assert.Equal(t, body1, body2)
+				assert.Equal(t, "", res1.Header.Get(httputil.HeaderXCache))
+				assert.Equal(t, httputil.CacheHit, res2.Header.Get(httputil.HeaderXCache))
+				assert.Equal(t, http.StatusOK, res2.StatusCode)
+
+				// other urls are cached separately
+				_, _ = get(t, client, "/ref?page=2")
+				assert.Equal(t, int32(2), callCtr.Load())
+			})
+			t.Run("revalidate with ETag", func(t *testing.T) {
+				var callCtr, notModified atomic.Int32
+				client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+					callCtr.Add(1)
+					w.Header().Set(httputil.HeaderCacheControl, "no-cache")
+					w.Header().Set(httputil.HeaderETag, `"v1"`)
+					if r.Header.Get(httputil.HeaderIfNoneMatch) == `"v1"` {
+						notModified.Add(1)
+						w.WriteHeader(http.StatusNotModified)
+						return
+					}
+					writeJSON(w, ResModel{ID: "v1"})
+				}).WithCache(httputil.NewCache(newStore(t)))
+
+				_, body1 := get(t, client, "/ref")
+				res2, body2 := get(t, client, "/ref")
+				assert.Equal(t, int32(2), callCtr.Load())
+				assert.Equal(t, int32(1), notModified.Load())
+				assert.Equal(t, http.StatusOK, res2.StatusCode)
+				assert.Equal(t, httputil.CacheRevalidated, res2.Header.Get(httputil.HeaderXCache))
+				assert.Equal(t, body1, body2)
+			})
+			t.Run("no-store", func(t *testing.T) {
+				var callCtr atomic.Int32
+				client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+					callCtr.Add(1)
+					w.Header().Set(httputil.HeaderCacheControl, "no-store, max-age=60")
+					writeJSON(w, ResModel{ID: "x"})
+				}).WithCache(httputil.NewCache(newStore(t)))
+
+				_, _ = get(t, client, "/ref")
+				_, _ = get(t, client, "/ref")
+				assert.Equal(t, int32(2), callCtr.Load())
+			})
+		})
+	}
+	t.Run("per API key", func(t *testing.T) {
+		var callCtr atomic.Int32
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			callCtr.Add(1)
+			w.Header().Set(httputil.HeaderCacheControl, "max-age=60")
+			writeJSON(w, ResModel{ID: r.Header.Get("X-API-Key")})
+		}).WithCache(httputil.NewCache(httputil.NewLRUCache(10)))
+		client = client.WithRedaction(client.Redaction.WithHeaders("X-API-Key"))
+		tenantA := client.WithSetHeader("X-API-Key", "a")
+		tenantB := client.WithSetHeader("X-API-Key", "b")
+
+		_, bodyA := get(t, tenantA, "/ref")
+		_, bodyB := get(t, tenantB, "/ref")
+		_, bodyA2 := get(t, tenantA, "/ref")
+		assert.Equal(t, int32(2), callCtr.Load())
+		assert.Contains(t, bodyA, `"a"`)
+		assert.Contains(t, bodyB, `"b"`)
+		assert.Equal(t, bodyA, bodyA2)
+	})
+	t.Run("uncacheable body not read", func(t *testing.T) {
+		var (
+			body *streamBody
+			hc   = doFunc(func(r *http.Request) (*http.Response, error) {
+				body = &streamBody{Reader: strings.NewReader("large download")}
+				return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Header: http.Header{}, Body: body, Request: r}, nil
+			})
+			client = httputil.NewClient().WithLogger(errLogger).WithHttpClient(hc).
+				WithLogPolicy(httputil.NewLogPolicy(httputil.LogSampleSuccess(100))). // only the first call reads the body to log it
+				WithCache(httputil.NewCache(httputil.NewLRUCache(10)))
+		)
+		for _, uri := range []string{"http://example.com/logged", "http://example.com/download"} {
+			req, err := client.Request(ctx, http.MethodGet, uri, nil, nil)
+			require.NoError(t, err)
+			res, err := client.Do(req)
+			require.NoError(t, err)
+			if uri == "http://example.com/download" {
+				assert.Same(t, body, res.Body, "left streaming")
+			}
+		}
+	})
+	t.Run("only GET", func(t *testing.T) {
+		var callCtr atomic.Int32
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			callCtr.Add(1)
+			w.Header().Set(httputil.HeaderCacheControl, "max-age=60")
+			w.WriteHeader(http.StatusOK)
+		}).WithCache(httputil.NewCache(httputil.NewLRUCache(10)))
+		for i := 0; i < 2; i++ {
+			req, err := client.Request(ctx, http.MethodPost, "/ref", nil, ReqModel{Name: "a"})
+			require.NoError(t, err)
+			_, err = client.Do(req)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, int32(2), callCtr.Load())
+	})
+}
+
+type streamBody struct{ io.Reader }
+
+func (*streamBody) Close() error { return nil }
+
+func TestLRUCache(t *testing.T) {
+	lru := httputil.NewLRUCache(2)
+	lru.Set("a", []byte("A"))
+	lru.Set("b", []byte("B"))
+	_, _ = lru.Get("a") // b is now the least recently used
+	lru.Set("c", []byte("C"))
+
+	_, ok := lru.Get("b")
+	assert.False(t, ok)
+	v, ok := lru.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, "A", string(v))
+	assert.Equal(t, 2, lru.Len())
+
+	lru.Delete("a")
+	_, ok = lru.Get("a")
+	assert.False(t, ok)
+}
@@ -3,19 +3,23 @@ package httputil
 import (
 	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 const (
 	HeaderReqID       = "X-Request-ID"
+	HeaderIdempotency = "Idempotency-Key"
 	HeaderContentType = "Content-Type"
 	ApplicationJSON   = "application/json"
-	Default429Retry   = 2
+	Default429Retry   = DefaultRetries
 )
 
 var (
@@ -25,12 +29,24 @@ var (
 type (
 	Client struct {
 		ReqHeaders
-		HttpClient   httpClient // *http.Client
-		Host         string
-		PathPrefix   string
-		log          sLogger
-		RateLimiter  *RateLimiter
-		RetriesOn429 int
+		HttpClient       httpClient // *http.Client
+		Host             string
+		PathPrefix       string
+		log              sLogger
+		RateLimiter      *RateLimiter
+		RetryPolicy      RetryPolicy
+		RetriesOn429     int // Deprecated: use RetryPolicy or With429Retry, when > 0 it replaces RetryPolicy with a 429 only policy
+		Middleware       []Middleware
+		StatusErrors     bool  // return *HTTPError from DoAndDecode when status >= 400
+		Codec            Codec // request body codec when the request has no Content-Type, defaults to JSONCodec
+		Cache            *Cache
+		CircuitBreaker   *CircuitBreaker
+		Redaction        Redaction  // secrets to mask in the logs, on top of the defaults
+		LogConfig        LogConfig  // what the RQ/RS log lines include
+		LogPolicy        *LogPolicy // which RQ/RS lines are written and at what level
+		Auth             Authenticator
+		IdempotencyKeys  bool              // add an Idempotency-Key to non-idempotent requests, the same on every retry
+		KeyedRateLimiter *KeyedRateLimiter // used instead of RateLimiter when set
 	}
 	httpClient interface { // *http.Client
 		Do(req *http.Request) (*http.Response, error)
@@ -42,14 +58,49 @@ func NewClient() Client {
 		WithLogger(slog.Default()).
 		WithHttpClient(defaultClient).
 		WithRateLimiter(NewRateLimiter(MaxAllowedCallsPerSecond)).
-		With429Retry(Default429Retry)
+		WithRetryPolicy(NewRetryPolicy(DefaultRetries))
 }
 func (c Client) WithHost(v string) Client              { c.Host = v; return c }
 func (c Client) WithPathPrefix(v string) Client        { c.PathPrefix = v; return c }
 func (c Client) WithLogger(v LevelLogger) Client       { c.log = newLogger(v); return c }
 func (c Client) WithHttpClient(v httpClient) Client    { c.HttpClient = v; return c }
 func (c Client) WithRateLimiter(v *RateLimiter) Client { c.RateLimiter = v; return c }
-func (c Client) With429Retry(v int) Client             { c.RetriesOn429 = v; return c }
+func (c Client) WithRetryPolicy(v RetryPolicy) Client  { c.RetryPolicy = v; return c }
+func (c Client) WithStatusErrors(v bool) Client        { c.StatusErrors = v; return c }
+func (c Client) WithCodec(v Codec) Client              { c.Codec = v; return c }
+func (c Client) WithCache(v *Cache) Client             { c.Cache = v; return c }
+func (c Client) WithRedaction(v Redaction) Client      { c.Redaction = v; return c }
+func (c Client) WithLogConfig(v LogConfig) Client      { c.LogConfig = v; return c }
+func (c Client) WithLogPolicy(v *LogPolicy) Client     { c.LogPolicy = v; return c }
+func (c Client) WithAuth(v Authenticator) Client       { c.Auth = v; return c }
+func (c Client) WithIdempotencyKeys(v bool) Client     { c.IdempotencyKeys = v; return c }
+func (c Client) WithCircuitBreaker(v *CircuitBreaker) Client {
+	c.CircuitBreaker = v
+	return c
+}
+func (c Client) WithKeyedRateLimiter(v *KeyedRateLimiter) Client {
+	c.KeyedRateLimiter = v
+	return c
+}
+
+// With429Retry is a shortcut for a RetryPolicy which only retries 429 responses
+func (c Client) With429Retry(v int) Client {
+	return c.WithRetryPolicy(NewRetryPolicy(v, RetryStatuses(http.StatusTooManyRequests)))
+}
+
+// retryPolicy is the RetryPolicy unless the deprecated RetriesOn429 was set
+func (c Client) retryPolicy() RetryPolicy {
+	if c.RetriesOn429 > 0 {
+		return NewRetryPolicy(c.RetriesOn429, RetryStatuses(http.StatusTooManyRequests))
+	}
+	return c.RetryPolicy
+}
+
+// WithMiddleware appends to the middleware chain, see Middleware for the order they run in
+func (c Client) WithMiddleware(mw ...Middleware) Client {
+	c.Middleware = append(slices.Clip(c.Middleware), mw...)
+	return c
+}
 func (c Client) WithHeader(h http.Header) Client {
 	c2 := c.Clone()
 	for k, v := range h {
@@ -63,21 +114,12 @@ func (c Client) WithSetHeader(k string, v ...string) Client {
 func (c Client) Clone() Client {
 	c2 := c
 	c2.ReqHeaders = c.ReqHeaders.Clone()
+	c2.Middleware = slices.Clone(c.Middleware)
 	return c2
 }
 
 func (c Client) DoReq(ctx context.Context, method string, r Request, out, errRes any) (*http.Response, error) {
-	if err := r.Validate(); err != nil {
-		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
-	}
-
-	var (
-		uri    = r.Path().WithBaseURL(c.Host).WithPrefix(c.PathPrefix).String()
-		header = r.Header()
-		body   = r
-	)
-
-	req, err := c.Request(ctx, method, uri, header, body)
+	req, err := c.modelRequest(ctx, method, r, r.Header())
 	if err != nil {
 		return nil, err
 	}
@@ -89,20 +131,33 @@ func (c Client) DoReq(ctx context.Context, method string, r Request, out, errRes
 	return res, nil
 }
 func (c Client) Request(ctx context.Context, method, uri string, headers http.Header, body any) (*http.Request, error) {
-	var reqBody io.Reader
+	var (
+		reqBody io.Reader
+		getBody func() (io.ReadCloser, error)
+		mp      *Multipart
+	)
+	if v, ok := body.(*Multipart); ok {
+		body = nil // a nil *Multipart is no body
+		if v != nil {
+			body = *v
+		}
+	}
 	if body != nil {
 		switch v := body.(type) {
+		case Multipart:
+			headers = withHeader(headers, HeaderContentType, v.ContentType())
+			mp = &v
 		case io.Reader:
-			reqBody = v
+			reqBody, getBody = replayableBody(v)
 		default:
-			bodyBytes, err := json.Marshal(body)
+			codec := c.requestCodec(headers)
+			bodyBytes, err := codec.Encode(body)
 			if err != nil {
-				return nil, fmt.Errorf("%s: %w", "jsonEncode(body) failed", err)
+				return nil, fmt.Errorf("%s: %w", "encode(body) failed", err)
 			}
-			if headers == nil {
-				headers = make(http.Header)
+			if headers.Get(HeaderContentType) == "" {
+				headers = withHeader(headers, HeaderContentType, codec.ContentType())
 			}
-			headers.Add(HeaderContentType, ApplicationJSON)
 			reqBody = bytes.NewReader(bodyBytes)
 		}
 	}
@@ -111,6 +166,16 @@ func (c Client) Request(ctx context.Context, method, uri string, headers http.He
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", "http.NewRequest failed", err)
 	}
+	if getBody != nil {
+		req.GetBody = getBody
+	}
+	if mp != nil {
+		// streamed, so the length is unknown and it is only replayable when every part is
+		req.Body = mp.Reader()
+		if mp.Replayable() {
+			req.GetBody = func() (io.ReadCloser, error) { return mp.Reader(), nil }
+		}
+	}
 
 	return reqWithHeaders(req, headers), nil
 }
@@ -119,75 +184,242 @@ func (c Client) DoAndDecode(req *http.Request, out, errRes any) (*http.Response,
 	if err != nil {
 		return nil, err
 	}
-	if _, err = DecodeResOrErrRes(res, out, errRes); err != nil {
+	body, err := DecodeResOrErrRes(res, out, errRes)
+	if c.StatusErrors && res.StatusCode >= 400 {
+		var problem *ProblemDetails
+		if errRes == nil && errors.As(err, &problem) {
+			errRes = problem
+		}
+		return res, newHTTPError(res, body, errRes, c.Redaction)
+	}
+	if err != nil {
 		return res, err
 	}
 	return res, nil
 }
+
+// Do sends the request and retries it according to the RetryPolicy
+// with IdempotencyKeys on, a POST or PATCH gets an Idempotency-Key unless it already has one
+// when the Auth is a Refresher a 401 response is refreshed and retried once, on top of the RetryPolicy
+// the wait between attempts is aborted when the request context is done
+// each retry resends the body using req.GetBody, which Request sets for every body
+// when a retry is needed but the body can not be replayed ErrBodyNotReplayable is returned
 func (c Client) Do(req *http.Request) (*http.Response, error) {
-	var tries = 0
-	res, err := c.do(req)
-	for res != nil && res.StatusCode == http.StatusTooManyRequests && tries < c.RetriesOn429 {
-		tries++
-		res, err = c.do(req)
+	if c.IdempotencyKeys && !isIdempotent(req) && req.Header.Get(HeaderIdempotency) == "" {
+		// set once here, outside of the attempts, so every retry sends the same key
+		req = req.Clone(req.Context())
+		req.Header.Set(HeaderIdempotency, uuid.NewString())
+	}
+	var (
+		policy    = c.retryPolicy()
+		roundTrip = c.roundTrip()
+		res, err  = roundTrip(withAttempt(req.Clone(req.Context()), 1, "")) // a copy like every retry, so middleware does not change req
+		refreshed bool
+	)
+	for attempt := 1; ; attempt++ {
+		var (
+			wait          time.Duration
+			retry, reauth bool
+		)
+		switch {
+		case !refreshed && c.unauthorized(res):
+			refreshed, reauth, retry = true, true, true
+		case policy != nil && refreshed:
+			// the refresh retry is not one of the policy's, so it still gets all of its own
+			wait, retry = policy.Retry(attempt-1, req, res, err)
+		case policy != nil:
+			wait, retry = policy.Retry(attempt, req, res, err)
+		}
+		if !retry {
+			break
+		}
+		reason := retryReason(res, c.Redaction.error(err))
+		discard(res)
+		if reauth {
+			if refreshErr := c.Auth.(Refresher).Refresh(rejectedRequest(req, res)); refreshErr != nil {
+				return nil, fmt.Errorf("%s: %w", "refresh auth failed", refreshErr)
+			}
+		}
+		if err := sleep(req.Context(), wait); err != nil {
+			return nil, err
+		}
+		next, rewindErr := rewindBody(req)
+		if rewindErr != nil {
+			return nil, rewindErr
+		}
+		res, err = roundTrip(withAttempt(next, attempt+1, reason))
 	}
 	return res, err
 }
 
 func (c Client) do(req *http.Request) (*http.Response, error) {
-	if err := c.RateLimiter.Wait(req.Context()); err != nil {
+	// each attempt gets its own copy so client headers are not added to req more than once
+	req = reqWithHeaders(req.Clone(req.Context()), c.Header())
+	cacheKey := cacheKey(req, c.Redaction.Headers)
+	cached, fresh := c.Cache.lookup(req, cacheKey)
+	if fresh {
+		return cached.response(req, CacheHit), nil
+	}
+	host := req.URL.Host
+	if err := c.CircuitBreaker.Allow(host); err != nil {
 		return nil, err
 	}
-	res, err := c.httpClient().Do(reqWithHeaders(req, c.Header()))
-	c.logRqRs(req, res, err)
-	if res != nil && res.StatusCode == http.StatusTooManyRequests {
-		c.RateLimiter.SlowDown()
+	var (
+		limiter   = c.rateLimiter(req)
+		waitStart = time.Now()
+	)
+	if err := limiter.Wait(req.Context()); err != nil {
+		c.CircuitBreaker.Done(host, nil, nil)
+		return nil, err
+	}
+	wait := time.Since(waitStart) // taken before Authenticate, a token fetch is not a rate limit wait
+	revalidating := c.Cache.revalidate(req, cached)
+	if c.Auth != nil {
+		if err := c.Auth.Authenticate(req); err != nil {
+			c.CircuitBreaker.Done(host, nil, nil)
+			return nil, fmt.Errorf("%s: %w", "authenticate failed", err)
+		}
+	}
+	start := time.Now()
+	res, err := c.httpClient().Do(req)
+	timing := rqrsTiming{wait: wait, elapsed: time.Since(start)}
+	if err != nil && req.Context().Err() != nil {
+		c.CircuitBreaker.Done(host, nil, nil) // canceled by the caller, not a failure of the host
+	} else {
+		c.CircuitBreaker.Done(host, res, err)
+	}
+	c.logRqRs(req, res, err, timing)
+	limiter.Observe(res)
+	switch {
+	case res == nil:
+	case res.StatusCode == http.StatusTooManyRequests:
+		limiter.SlowDown()
+	case res.StatusCode < http.StatusInternalServerError:
+		limiter.Success()
+	}
+	if err == nil {
+		res = c.Cache.update(req, cacheKey, res, cached, revalidating)
 	}
 	return res, err
 }
+
+// rateLimiter is the limiter req waits on, from the KeyedRateLimiter when there is one
+func (c Client) rateLimiter(req *http.Request) *RateLimiter {
+	if c.KeyedRateLimiter != nil {
+		return c.KeyedRateLimiter.For(req)
+	}
+	return c.RateLimiter
+}
+
+// modelRequest validates r and then builds the request from its Path, Header and body
+// modelRequest builds the request for r with headers, which the caller takes from r.Header()
+func (c Client) modelRequest(ctx context.Context, method string, r Request, headers http.Header) (*http.Request, error) {
+	if err := r.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidRequest, err)
+	}
+	uri := r.Path().WithBaseURL(c.Host).WithPrefix(c.PathPrefix).String()
+	if ir, ok := r.(IdempotentRequest); ok && ir.IdempotencyKey() != "" {
+		headers = withHeader(headers, HeaderIdempotency, ir.IdempotencyKey())
+	}
+	return c.Request(ctx, method, uri, headers, requestBody(r))
+}
+func (c Client) requestCodec(headers http.Header) Codec {
+	if codec, ok := CodecFor(headers.Get(HeaderContentType)); ok {
+		return codec
+	}
+	if c.Codec != nil {
+		return c.Codec
+	}
+	return JSONCodec{}
+}
 func (c Client) httpClient() httpClient {
 	if c.HttpClient != nil {
 		return c.HttpClient
 	}
 	return defaultClient
 }
-func (c Client) logRqRs(req *http.Request, res *http.Response, err error) {
-	msg := fmt.Sprintf("[RQ/RS] %s %s", req.Method, req.URL.Path)
-	reqFields := fMap{
-		"method": req.Method,
-		"path":   req.URL.Path,
-		"header": req.Header,
-		"query":  req.URL.RawQuery,
+func (c Client) logRqRs(req *http.Request, res *http.Response, err error, timing rqrsTiming) {
+	var (
+		ctx = req.Context()
+		msg = fmt.Sprintf("[RQ/RS] %s %s", req.Method, req.URL.Path)
+	)
+	if err == nil {
+		msg += " " + res.Status
+	}
+	level, ok := c.LogPolicy.level(res, err, timing.elapsed)
+	if !ok {
+		return
+	}
+	err = c.Redaction.error(err)
+	var suppressed int
+	if err != nil || res.StatusCode >= 400 {
+		line := msg
+		if err != nil {
+			line += " " + err.Error()
+		}
+		if suppressed, ok = c.LogPolicy.dedupe(line); !ok {
+			return
+		}
+	}
+
+	var (
+		reqFields = fMap{
+			"method": req.Method,
+			"host":   req.URL.Host,
+			"path":   req.URL.Path,
+			"header": c.Redaction.header(req.Header),
+			"query":  c.Redaction.query(req.URL.RawQuery),
+		}
+		fields = fMap{
+			"req":           reqFields,
+			"elapsed":       timing.elapsed,
+			"rateLimitWait": timing.wait,
+		}
+	)
+	limit := c.LogConfig.reqBodyLimit()
+	c.logBody(reqFields, req.Header, reqBody(req, limit), limit)
+	if attempt, ok := attemptFrom(req.Context()); ok {
+		fields["attempt"] = attempt.n
+		if attempt.reason != "" {
+			fields["retryReason"] = attempt.reason
+		}
+	}
+	if id := req.Header.Get(HeaderReqID); id != "" {
+		fields["requestId"] = id
+	}
+	if key := req.Header.Get(HeaderIdempotency); key != "" {
+		fields["idempotencyKey"] = key
+	}
+	if suppressed > 0 {
+		fields["suppressed"] = suppressed
 	}
 
 	if err != nil {
-		c.log.Error(msg, fMap{
-			"req":   reqFields,
-			"error": err.Error(),
-		})
+		fields["error"] = err.Error()
+		c.log.Log(ctx, level, msg, c.LogConfig.omit(fields))
 		return
 	}
 
 	resFields := fMap{
 		"status": res.Status,
-		"header": res.Header,
+		"header": c.Redaction.header(res.Header),
 	}
-	var out = make(map[string]any)
-	if bodyBytes, err := DecodeResponse(res, &out); err == nil {
-		if len(bodyBytes) < 1024 {
-			resFields["body"] = out
-		} else {
-			resFields["head"] = string(bodyBytes[:1024])
-		}
+	bodyBytes, _ := DecodeResponse(res, nil)
+	c.logBody(resFields, res.Header, bodyBytes, c.LogConfig.resBodyLimit())
+	fields["res"] = resFields
+	if res.Request != nil && res.Request.URL != nil {
+		reqFields["host"] = res.Request.URL.Host // where a redirect ended up
 	}
-	fields := fMap{
-		"req": reqFields,
-		"res": resFields,
+	if id := res.Header.Get(HeaderReqID); id != "" {
+		fields["requestId"] = id
 	}
-	msg += " " + res.Status
-	if res.StatusCode >= 400 {
-		c.log.Warn(msg, fields)
+	if c.LogConfig.DebugBodies && res.StatusCode < 400 {
+		bodies := fMap{"req": takeBody(reqFields), "res": takeBody(resFields)}
+		c.log.Log(ctx, level, msg, c.LogConfig.omit(fields))
+		if c.log.DebugEnabled(ctx) {
+			c.log.Debug(ctx, msg+" bodies", c.LogConfig.omit(bodies))
+		}
 		return
 	}
-	c.log.Info(msg, fields)
+	c.log.Log(ctx, level, msg, c.LogConfig.omit(fields))
 }
@@ -0,0 +1,275 @@
+package httputil
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ApplicationXML  = "application/xml"
+	ApplicationForm = "application/x-www-form-urlencoded"
+	TextXML         = "text/xml"
+	TextPlain       = "text/plain"
+)
+
+type (
+	// Codec encodes request bodies and decodes response bodies of one content type
+	// Client.Request encodes with the codec registered for the Content-Type header
+	// of the request, else with the client codec, else with JSONCodec
+	// DecodeResponse decodes with the codec registered for the response Content-Type
+	Codec interface {
+		ContentType() string
+		Encode(v any) ([]byte, error)
+		Decode(r io.Reader, v any) error
+	}
+	JSONCodec struct{}
+	XMLCodec  struct{}
+	FormCodec struct{} // url.Values, map[string]string, map[string][]string or a struct using `form` tags
+	TextCodec struct{} // string, []byte, fmt.Stringer or encoding.TextMarshaler
+)
+
+var (
+	ErrCodecUnsupported = errors.New("codec does not support type")
+
+	reqHeadersType = reflect.TypeOf(ReqHeaders{})
+
+	codecs = struct {
+		sync.RWMutex
+		m map[string]Codec
+	}{m: map[string]Codec{
+		ApplicationJSON: JSONCodec{},
+		ApplicationXML:  XMLCodec{},
+		TextXML:         XMLCodec{},
+		ApplicationForm: FormCodec{},
+		TextPlain:       TextCodec{},
+	}}
+)
+
+// RegisterCodec makes c available for the media type of c.ContentType()
+// replacing any codec already registered for it
+func RegisterCodec(c Codec) {
+	codecs.Lock()
+	defer codecs.Unlock()
+	codecs.m[mediaType(c.ContentType())] = c
+}
+
+// CodecFor returns the codec registered for contentType
+// types with a +json or +xml suffix fall back to the json or xml codec
+func CodecFor(contentType string) (Codec, bool) {
+	mt := mediaType(contentType)
+	if mt == "" {
+		return nil, false
+	}
+	codecs.RLock()
+	defer codecs.RUnlock()
+	if c, ok := codecs.m[mt]; ok {
+		return c, true
+	}
+	switch {
+	case strings.HasSuffix(mt, "+json"):
+		return codecs.m[ApplicationJSON], true
+	case strings.HasSuffix(mt, "+xml"):
+		return codecs.m[ApplicationXML], true
+	}
+	return nil, false
+}
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+func (JSONCodec) ContentType() string             { return ApplicationJSON }
+func (JSONCodec) Encode(v any) ([]byte, error)    { return json.Marshal(v) }
+func (JSONCodec) Decode(r io.Reader, v any) error { return json.NewDecoder(r).Decode(v) }
+func (XMLCodec) ContentType() string              { return ApplicationXML }
+func (XMLCodec) Encode(v any) ([]byte, error)     { return xml.Marshal(v) }
+func (XMLCodec) Decode(r io.Reader, v any) error  { return xml.NewDecoder(r).Decode(v) }
+func (FormCodec) ContentType() string             { return ApplicationForm }
+func (TextCodec) ContentType() string             { return TextPlain + "; charset=utf-8" }
+
+func (FormCodec) Encode(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case url.Values:
+		return []byte(v.Encode()), nil
+	case map[string][]string:
+		return []byte(url.Values(v).Encode()), nil
+	case map[string]string:
+		vals := make(url.Values, len(v))
+		for k, val := range v {
+			vals.Set(k, val)
+		}
+		return []byte(vals.Encode()), nil
+	}
+	rv := reflect.Indirect(reflect.ValueOf(v))
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: %T", ErrCodecUnsupported, v)
+	}
+	vals := make(url.Values)
+	formValues(rv, vals)
+	return []byte(vals.Encode()), nil
+}
+func (FormCodec) Decode(r io.Reader, v any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	vals, err := url.ParseQuery(string(b))
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case *url.Values:
+		*v = vals
+		return nil
+	case *map[string][]string:
+		*v = vals
+		return nil
+	case *map[string]string:
+		*v = make(map[string]string, len(vals))
+		for k := range vals {
+			(*v)[k] = vals.Get(k)
+		}
+		return nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: %T", ErrCodecUnsupported, v)
+	}
+	return setFormValues(rv.Elem(), vals)
+}
+
+func (TextCodec) Encode(v any) ([]byte, error) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), nil
+	case []byte:
+		return v, nil
+	case encoding.TextMarshaler:
+		return v.MarshalText()
+	case fmt.Stringer:
+		return []byte(v.String()), nil
+	}
+	return nil, fmt.Errorf("%w: %T", ErrCodecUnsupported, v)
+}
+func (TextCodec) Decode(r io.Reader, v any) error {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	switch v := v.(type) {
+	case *string:
+		*v = string(b)
+	case *[]byte:
+		*v = b
+	case encoding.TextUnmarshaler:
+		return v.UnmarshalText(b)
+	default:
+		return fmt.Errorf("%w: %T", ErrCodecUnsupported, v)
+	}
+	return nil
+}
+
+// formFields walks the exported fields of a struct, and of embedded structs,
+// calling fn with the form name of each, the name is the `form` tag else the field name
+// a tag of "-" skips the field and ",omitempty" skips zero values
+func formFields(rv reflect.Value, fn func(name string, fv reflect.Value, omitEmpty bool)) {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		var (
+			f        = rt.Field(i)
+			fv       = rv.Field(i)
+			tag, set = f.Tag.Lookup("form")
+		)
+		if !f.IsExported() || tag == "-" || f.Type == reqHeadersType {
+			continue
+		}
+		if f.Anonymous && !set && reflect.Indirect(fv).Kind() == reflect.Struct {
+			if fv.Kind() == reflect.Pointer && fv.IsNil() {
+				continue
+			}
+			formFields(reflect.Indirect(fv), fn)
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fn(name, fv, opts == "omitempty")
+	}
+}
+func formValues(rv reflect.Value, vals url.Values) {
+	formFields(rv, func(name string, fv reflect.Value, omitEmpty bool) {
+		if omitEmpty && fv.IsZero() {
+			return
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8 {
+			for i := 0; i < fv.Len(); i++ {
+				vals.Add(name, fmt.Sprint(fv.Index(i).Interface()))
+			}
+			return
+		}
+		vals.Set(name, fmt.Sprint(fv.Interface()))
+	})
+}
+func setFormValues(rv reflect.Value, vals url.Values) error {
+	var err error
+	formFields(rv, func(name string, fv reflect.Value, _ bool) {
+		if _, ok := vals[name]; !ok || err != nil {
+			return
+		}
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.String {
+			fv.Set(reflect.ValueOf(append([]string(nil), vals[name]...)).Convert(fv.Type()))
+			return
+		}
+		if e := setFormValue(fv, vals.Get(name)); e != nil {
+			err = fmt.Errorf("form field %s: %w", name, e)
+		}
+	})
+	return err
+}
+func setFormValue(fv reflect.Value, s string) error {
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(n)
+	default:
+		return fmt.Errorf("%w: %s", ErrCodecUnsupported, fv.Type())
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package httputil_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+type (
+	XMLPerson struct {
+		XMLName xml.Name `xml:"person"`
+		Name    string   `xml:"name"`
+	}
+	FormLogin struct {
+		httputil.ReqHeaders
+		User     string   `form:"user"`
+		Age      int      `form:"age"`
+		Remember bool     `form:"remember,omitempty"`
+		Scopes   []string `form:"scope"`
+		Secret   string   `form:"-"`
+	}
+)
+
+func TestClient_Codec(t *testing.T) {
+	t.Run("xml per client", func(t *testing.T) {
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, httputil.ApplicationXML, r.Header.Get(httputil.HeaderContentType))
+			var in XMLPerson
+			assert.NoError(t, xml.NewDecoder(r.Body).Decode(&in))
+			w.Header().Set(httputil.HeaderContentType, "text/xml; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			_ = xml.NewEncoder(w).Encode(XMLPerson{Name: in.Name + "!"})
+		}).WithCodec(httputil.XMLCodec{})
+
+		req, err := client.Request(ctx, http.MethodPost, "/", nil, XMLPerson{Name: "Robert"})
+		require.NoError(t, err)
+		var out XMLPerson
+		_, err = client.DoAndDecode(req, &out, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "Robert!", out.Name)
+	})
+	t.Run("form per request", func(t *testing.T) {
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, httputil.ApplicationForm, r.Header.Get(httputil.HeaderContentType))
+			assert.NoError(t, r.ParseForm())
+			assert.Equal(t, url.Values{
+				"user":  {"bob"},
+				"age":   {"42"},
+				"scope": {"a", "b"},
+			}, r.PostForm)
+			w.Header().Set(httputil.HeaderContentType, httputil.ApplicationForm)
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("user=bob&age=43&remember=true"))
+		})
+		var (
+			in     = FormLogin{User: "bob", Age: 42, Scopes: []string{"a", "b"}, Secret: "shh"}
+			header = http.Header{httputil.HeaderContentType: {httputil.ApplicationForm}}
+			out    FormLogin
+		)
+		req, err := client.Request(ctx, http.MethodPost, "/", header, in)
+		require.NoError(t, err)
+		_, err = client.DoAndDecode(req, &out, nil)
+		require.NoError(t, err)
+		assert.Equal(t, FormLogin{User: "bob", Age: 43, Remember: true}, out)
+		assert.Len(t, header.Values(httputil.HeaderContentType), 1, "headers passed in are not modified")
+	})
+	t.Run("text", func(t *testing.T) {
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			b, _ := io.ReadAll(r.Body)
+			assert.Equal(t, "ping", string(b))
+			w.Header().Set(httputil.HeaderContentType, "text/plain; charset=utf-8")
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte("pong"))
+		}).WithCodec(httputil.TextCodec{})
+
+		req, err := client.Request(ctx, http.MethodPost, "/", nil, "ping")
+		require.NoError(t, err)
+		var out string
+		_, err = client.DoAndDecode(req, &out, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "pong", out)
+	})
+	t.Run("unsupported type", func(t *testing.T) {
+		client := httputil.NewClient().WithCodec(httputil.FormCodec{})
+		_, err := client.Request(ctx, http.MethodPost, "/", nil, 42)
+		assert.ErrorIs(t, err, httputil.ErrCodecUnsupported)
+	})
+}
+func TestCodecFor(t *testing.T) {
+	var tests = map[string]httputil.Codec{
+		"application/json":                  httputil.JSONCodec{},
+		"application/json; charset=utf-8":   httputil.JSONCodec{},
+		"application/vnd.api+json":          httputil.JSONCodec{},
+		"application/problem+json":          httputil.JSONCodec{},
+		"application/xml":                   httputil.XMLCodec{},
+		"text/xml; charset=utf-8":           httputil.XMLCodec{},
+		"application/atom+xml":              httputil.XMLCodec{},
+		"application/x-www-form-urlencoded": httputil.FormCodec{},
+		"text/plain":                        httputil.TextCodec{},
+		"image/png":                         nil,
+		"":                                  nil,
+	}
+	for contentType, expect := range tests {
+		t.Run(contentType, func(t *testing.T) {
+			codec, ok := httputil.CodecFor(contentType)
+			assert.Equal(t, expect != nil, ok)
+			assert.Equal(t, expect, codec)
+		})
+	}
+}
+func TestRegisterCodec(t *testing.T) {
+	const contentType = "application/x-test-codec"
+	httputil.RegisterCodec(testCodec{})
+	codec, ok := httputil.CodecFor(contentType + "; v=1")
+	require.True(t, ok)
+	assert.Equal(t, testCodec{}, codec)
+}
+
+type testCodec struct{ httputil.TextCodec }
+
+func (testCodec) ContentType() string { return "application/x-test-codec" }
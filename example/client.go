@@ -19,8 +19,9 @@ type Client struct {
 }
 
 func NewClient(baseURL string) Client {
+	base := httputil.NewClient()
 	return new(Client).
-		withBase(httputil.NewClient()).
+		withBase(base.WithRedaction(base.Redaction.WithHeaders(headerAPIKey, headerAPISecret))).
 		WithBaseURL(baseURL).
 		WithLogger(slog.Default())
 }
@@ -0,0 +1,76 @@
+package httputil_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_WithAuth_hmac(t *testing.T) {
+	var (
+		key    = []byte("s3cr3t")
+		tsCtr  atomic.Int32
+		signer = httputil.NewHMACSigner(key,
+			httputil.HMACKeyID("X-Key-ID", "key-1"),
+			httputil.HMACTimestamp(func(time.Time) string { return fmt.Sprint(tsCtr.Add(1)) }),
+		)
+		mu         sync.Mutex
+		timestamps []string
+		callCtr    atomic.Int32
+	)
+	client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		if !assert.NoError(t, err) {
+			return
+		}
+		var (
+			ts       = r.Header.Get(httputil.HeaderTimestamp)
+			bodySum  = sha256.Sum256(body)
+			expected = "PUT\n/ref/1\na=1&b=2&b=3\n" + ts + "\n" + hex.EncodeToString(bodySum[:])
+			mac      = hmac.New(sha256.New, key)
+		)
+		assert.Equal(t, expected, signer.CanonicalString(r, ts, body))
+		mac.Write([]byte(expected))
+		assert.Equal(t, hex.EncodeToString(mac.Sum(nil)), r.Header.Get(httputil.HeaderSignature))
+		assert.Equal(t, "key-1", r.Header.Get("X-Key-ID"))
+
+		mu.Lock()
+		timestamps = append(timestamps, ts)
+		mu.Unlock()
+		if callCtr.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).
+		WithRetryPolicy(httputil.NewRetryPolicy(1, httputil.RetryDelay(time.Millisecond, time.Millisecond))).
+		WithAuth(signer)
+
+	req, err := client.Request(ctx, http.MethodPut, "/ref/1?b=2&a=1&b=3", nil, ReqModel{Name: "Robert"})
+	require.NoError(t, err)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []string{"1", "2"}, timestamps, "signed again on retry")
+}
+func TestHMACSigner_CanonicalString(t *testing.T) {
+	signer := httputil.NewHMACSigner(nil, httputil.HMACTemplate("{timestamp}.{method} {host}{path} {header:X-Foo} {unknown}"))
+	req, err := http.NewRequest(http.MethodGet, "https://example.com/a%20b", nil)
+	require.NoError(t, err)
+	req.Header.Set("X-Foo", "bar")
+	assert.Equal(t, "42.GET example.com/a%20b bar {unknown}", signer.CanonicalString(req, "42", nil))
+}
@@ -0,0 +1,86 @@
+package httputil
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// HTTPError is returned by DoAndDecode and DoReq for status >= 400
+// when the client is configured WithStatusErrors(true)
+// use errors.Is with ErrNotFound, ErrServerError, etc. to check the status class
+// and errors.As to get at the HTTPError itself, if errRes implements error it is unwrapped
+type HTTPError struct {
+	StatusCode int
+	Status     string
+	Header     http.Header
+	Method     string
+	URL        string // as sent, Error masks the query with the Redaction of the client
+	Body       []byte // raw response body
+	ErrRes     any    // the errRes passed to DoAndDecode after decoding
+	redaction  Redaction
+}
+
+var (
+	ErrClientError  = errors.New("client error")      // 4xx
+	ErrServerError  = errors.New("server error")      // 5xx
+	ErrBadRequest   = errors.New("bad request")       // 400
+	ErrUnauthorized = errors.New("unauthorized")      // 401
+	ErrForbidden    = errors.New("forbidden")         // 403
+	ErrNotFound     = errors.New("not found")         // 404
+	ErrConflict     = errors.New("conflict")          // 409
+	ErrRateLimited  = errors.New("too many requests") // 429
+)
+
+func newHTTPError(res *http.Response, body []byte, errRes any, redaction Redaction) *HTTPError {
+	e := &HTTPError{
+		StatusCode: res.StatusCode,
+		Status:     res.Status,
+		Header:     res.Header,
+		Body:       body,
+		ErrRes:     errRes,
+		redaction:  redaction,
+	}
+	if e.Status == "" {
+		e.Status = fmt.Sprintf("%d %s", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+	if res.Request != nil {
+		e.Method = res.Request.Method
+		e.URL = res.Request.URL.String()
+	}
+	return e
+}
+func (e *HTTPError) Error() string {
+	msg := fmt.Sprintf("%s %s: %s", e.Method, e.redaction.url(e.URL), e.Status)
+	if err := e.Unwrap(); err != nil && err.Error() != "" {
+		msg += ": " + err.Error()
+	}
+	return msg
+}
+func (e *HTTPError) Unwrap() error {
+	if err, ok := e.ErrRes.(error); ok {
+		return err
+	}
+	return nil
+}
+func (e *HTTPError) Is(target error) bool {
+	switch target {
+	case ErrClientError:
+		return e.StatusCode >= 400 && e.StatusCode < 500
+	case ErrServerError:
+		return e.StatusCode >= 500
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package httputil_test
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+	"github.com/tempcke/httputil/example"
+)
+
+func TestClient_WithStatusErrors(t *testing.T) {
+	var (
+		apiErr = example.APIError{
+			Code:    42,
+			Message: uuid.NewString(),
+		}
+		req = example.NewStorePropertyReq(example.Property{
+			ID:     uuid.NewString(),
+			Street: "1901 Main st",
+			City:   "Dallas",
+			State:  "TX",
+			Zip:    "75201",
+		})
+		clientWithStatus = func(t *testing.T, status int) httputil.Client {
+			return clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Foo", "foo")
+				w.WriteHeader(status)
+				writeJSON(w, example.ErrorResponse{APIError: apiErr})
+			})
+		}
+	)
+	t.Run("off by default", func(t *testing.T) {
+		var (
+			client = clientWithStatus(t, http.StatusNotFound)
+			out    example.StorePropertyRes
+			errRes example.ErrorResponse
+		)
+		res, err := client.DoReq(ctx, http.MethodPost, &req, &out, &errRes)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+	t.Run("not found", func(t *testing.T) {
+		var (
+			client = clientWithStatus(t, http.StatusNotFound).WithStatusErrors(true)
+			out    example.StorePropertyRes
+			errRes example.ErrorResponse
+		)
+		res, err := client.DoReq(ctx, http.MethodPost, &req, &out, &errRes)
+		require.Error(t, err)
+		assert.Equal(t, http.StatusNotFound, res.StatusCode)
+		assert.ErrorIs(t, err, httputil.ErrNotFound)
+		assert.ErrorIs(t, err, httputil.ErrClientError)
+		assert.NotErrorIs(t, err, httputil.ErrServerError)
+		assert.NotErrorIs(t, err, httputil.ErrUnauthorized)
+
+		var httpErr *httputil.HTTPError
+		require.True(t, errors.As(err, &httpErr))
+		assert.Equal(t, http.StatusNotFound, httpErr.StatusCode)
+		assert.Equal(t, http.MethodPost, httpErr.Method)
+		assert.Contains(t, httpErr.URL, req.Path().String())
+		assert.Equal(t, "foo", httpErr.Header.Get("X-Foo"))
+		assert.Contains(t, string(httpErr.Body), apiErr.Message)
+
+		// errRes is decoded and unwrapped because it implements error
+		assert.Equal(t, apiErr, errRes.APIError)
+		var er *example.ErrorResponse
+		require.True(t, errors.As(err, &er))
+		assert.Equal(t, apiErr, er.APIError)
+		assert.Contains(t, err.Error(), apiErr.Message)
+	})
+	t.Run("server error", func(t *testing.T) {
+		client := clientWithStatus(t, http.StatusInternalServerError).WithStatusErrors(true)
+		_, err := client.DoReq(ctx, http.MethodPost, &req, nil, nil)
+		assert.ErrorIs(t, err, httputil.ErrServerError)
+		assert.NotErrorIs(t, err, httputil.ErrClientError)
+	})
+	t.Run("rate limited", func(t *testing.T) {
+		client := clientWithStatus(t, http.StatusTooManyRequests).
+			WithStatusErrors(true).With429Retry(0)
+		_, err := client.DoReq(ctx, http.MethodPost, &req, nil, nil)
+		assert.ErrorIs(t, err, httputil.ErrRateLimited)
+	})
+	t.Run("query redacted", func(t *testing.T) {
+		client := clientWithStatus(t, http.StatusBadRequest).WithStatusErrors(true)
+		client = client.WithRedaction(client.Redaction.WithQuery("sig"))
+		r, err := client.Request(ctx, http.MethodGet, "/ref?page=2&api_key=SECRET1&sig=SECRET2", nil, nil)
+		require.NoError(t, err)
+		_, err = client.DoAndDecode(r, nil, nil)
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "SECRET")
+		assert.Contains(t, err.Error(), "page=2")
+		assert.Contains(t, err.Error(), httputil.Redacted)
+	})
+}
@@ -0,0 +1,306 @@
+// Package httputiltest is a scriptable fake API for testing clients built on httputil.Client
+package httputiltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tempcke/httputil"
+)
+
+type (
+	// Server is a fake API, register the routes you expect with On and queue the responses they give
+	// a request which matches no route gets a 404 and fails the test
+	Server struct {
+		*httptest.Server
+		t        testing.TB
+		mu       sync.Mutex
+		routes   []*Route
+		requests []Request
+	}
+
+	// Route serves its queued responses in order, the last one is repeated once the queue runs out
+	// a route with no responses queued answers 200 with no body
+	Route struct {
+		method    string
+		path      httputil.Path
+		server    *Server
+		responses []Response
+		requests  []Request
+	}
+
+	// Response is a canned response, Body is sent as is when it is a string or []byte and as JSON otherwise
+	Response struct {
+		Status int
+		Header http.Header
+		Body   any
+		Delay  time.Duration // before the response is written
+	}
+
+	// Request is a request the Server received
+	Request struct {
+		Method string
+		Path   string
+		Params map[string]string // values of the route template params
+		Query  url.Values
+		Header http.Header
+		Body   []byte
+		t      testing.TB
+	}
+)
+
+// NewServer starts a Server which is closed when the test ends
+func NewServer(t testing.TB) *Server {
+	s := &Server{t: t}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Client returns an httputil.Client for the Server, without retries so every call is one request
+func (s *Server) Client() httputil.Client {
+	return httputil.NewClient().
+		WithHost(s.URL).
+		WithRetryPolicy(nil)
+}
+
+// On registers a route for method and a Path template such as "/users/:id"
+func (s *Server) On(method, template string) *Route {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r := &Route{method: method, path: httputil.NewPath(template), server: s}
+	s.routes = append(s.routes, r)
+	return r
+}
+
+// Requests returns every request the Server received, matched or not
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request(nil), s.requests...)
+}
+
+// AssertAllCalled fails the test for each route which was never called
+func (s *Server) AssertAllCalled() bool {
+	s.t.Helper()
+	s.mu.Lock()
+	routes := append([]*Route(nil), s.routes...)
+	s.mu.Unlock()
+	ok := true
+	for _, r := range routes {
+		if r.Calls() == 0 {
+			s.t.Errorf("httputiltest: %s was never called", r)
+			ok = false
+		}
+	}
+	return ok
+}
+func (s *Server) serveHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	rq := Request{
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.Query(),
+		Header: req.Header.Clone(),
+		Body:   body,
+		t:      s.t,
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, rq)
+	var (
+		route *Route
+		res   Response
+	)
+	for _, r := range s.routes {
+		if params, ok := r.match(req); ok {
+			rq.Params = params
+			route, res = r, r.next()
+			r.requests = append(r.requests, rq)
+			break
+		}
+	}
+	s.mu.Unlock()
+
+	if route == nil {
+		s.t.Errorf("httputiltest: unexpected request %s %s", req.Method, req.URL)
+		http.NotFound(w, req)
+		return
+	}
+	res.write(w)
+}
+
+// Respond queues responses, see Route for the order they are served in
+func (r *Route) Respond(responses ...Response) *Route {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	r.responses = append(r.responses, responses...)
+	return r
+}
+
+// Calls returns how many requests the route received
+func (r *Route) Calls() int {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	return len(r.requests)
+}
+
+// Requests returns the requests the route received in the order they arrived
+func (r *Route) Requests() []Request {
+	r.server.mu.Lock()
+	defer r.server.mu.Unlock()
+	return append([]Request(nil), r.requests...)
+}
+
+// Last returns the latest request the route received and fails the test when there is none
+func (r *Route) Last() Request {
+	r.server.t.Helper()
+	requests := r.Requests()
+	if len(requests) == 0 {
+		r.server.t.Fatalf("httputiltest: %s was never called", r)
+	}
+	return requests[len(requests)-1]
+}
+
+// AssertCalls fails the test unless the route received exactly n requests
+func (r *Route) AssertCalls(n int) bool {
+	r.server.t.Helper()
+	if calls := r.Calls(); calls != n {
+		r.server.t.Errorf("httputiltest: %s called %d times, want %d", r, calls, n)
+		return false
+	}
+	return true
+}
+func (r *Route) String() string {
+	return r.method + " " + r.path.String()
+}
+func (r *Route) match(req *http.Request) (map[string]string, bool) {
+	if r.method != req.Method {
+		return nil, false
+	}
+	return r.path.Match(req.URL.Path)
+}
+
+// next pops the next response, leaving the last one to be repeated
+func (r *Route) next() Response {
+	if len(r.responses) == 0 {
+		return Response{Status: http.StatusOK}
+	}
+	res := r.responses[0]
+	if len(r.responses) > 1 {
+		r.responses = r.responses[1:]
+	}
+	return res
+}
+
+// Status is a response with no body
+func Status(code int) Response {
+	return Response{Status: code}
+}
+
+// JSON is a response with body encoded as JSON
+func JSON(code int, body any) Response {
+	return Response{Status: code, Body: body}
+}
+
+// TooManyRequests is a 429 with Retry-After set to retryAfter, rounded up to whole seconds
+func TooManyRequests(retryAfter time.Duration) Response {
+	secs := int((retryAfter + time.Second - 1) / time.Second)
+	return Status(http.StatusTooManyRequests).WithHeader(httputil.HeaderRetryAfter, strconv.Itoa(secs))
+}
+func (res Response) WithHeader(k, v string) Response {
+	res.Header = res.Header.Clone()
+	if res.Header == nil {
+		res.Header = make(http.Header)
+	}
+	res.Header.Set(k, v)
+	return res
+}
+func (res Response) WithDelay(d time.Duration) Response {
+	res.Delay = d
+	return res
+}
+func (res Response) write(w http.ResponseWriter) {
+	if res.Delay > 0 {
+		time.Sleep(res.Delay)
+	}
+	var body []byte
+	switch v := res.Body.(type) {
+	case nil:
+	case []byte:
+		body = v
+	case string:
+		body = []byte(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("httputiltest: encode body failed: %v", err), http.StatusInternalServerError)
+			return
+		}
+		body = b
+		w.Header().Set(httputil.HeaderContentType, httputil.ApplicationJSON)
+	}
+	for k, v := range res.Header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(max(res.Status, http.StatusOK))
+	_, _ = w.Write(body)
+}
+
+// Decode decodes the JSON body of the request into v
+func (r Request) Decode(v any) error {
+	return json.Unmarshal(r.Body, v)
+}
+
+// AssertHeader fails the test unless the request has the header k set to v
+func (r Request) AssertHeader(k, v string) bool {
+	r.t.Helper()
+	if got := r.Header.Get(k); got != v {
+		r.t.Errorf("httputiltest: %s %s header %s is %q, want %q", r.Method, r.Path, k, got, v)
+		return false
+	}
+	return true
+}
+
+// AssertJSON fails the test unless the body is JSON equal to want, which is encoded first unless it is a string or []byte
+func (r Request) AssertJSON(want any) bool {
+	r.t.Helper()
+	var wantBytes []byte
+	switch v := want.(type) {
+	case []byte:
+		wantBytes = v
+	case string:
+		wantBytes = []byte(v)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			r.t.Errorf("httputiltest: encode want failed: %v", err)
+			return false
+		}
+		wantBytes = b
+	}
+	var got, expected any
+	if err := json.Unmarshal(wantBytes, &expected); err != nil {
+		r.t.Errorf("httputiltest: want is not JSON: %v", err)
+		return false
+	}
+	if err := json.Unmarshal(r.Body, &got); err != nil || !jsonEqual(got, expected) {
+		r.t.Errorf("httputiltest: %s %s body is %s, want %s", r.Method, r.Path, r.Body, wantBytes)
+		return false
+	}
+	return true
+}
+func jsonEqual(a, b any) bool {
+	ab, _ := json.Marshal(a)
+	bb, _ := json.Marshal(b)
+	return bytes.Equal(ab, bb)
+}
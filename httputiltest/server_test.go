@@ -0,0 +1,108 @@
+package httputiltest_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+	"github.com/tempcke/httputil/httputiltest"
+)
+
+var ctx = context.Background()
+
+type user struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestServer(t *testing.T) {
+	srv := httputiltest.NewServer(t)
+	getUser := srv.On(http.MethodGet, "/users/:id").
+		Respond(httputiltest.JSON(http.StatusOK, user{ID: "1", Name: "Robert"}))
+	putUser := srv.On(http.MethodPut, "/users/:id")
+	client := srv.Client().WithSetHeader("X-API-Key", "key")
+
+	var out user
+	_, err := client.DoReq(ctx, http.MethodGet, userReq{id: "1"}, &out, nil)
+	require.NoError(t, err)
+	assert.Equal(t, user{ID: "1", Name: "Robert"}, out)
+
+	_, err = client.DoReq(ctx, http.MethodPut, userReq{id: "1", body: user{Name: "Bob"}}, nil, nil)
+	require.NoError(t, err)
+
+	getUser.AssertCalls(1)
+	putUser.AssertCalls(1)
+	srv.AssertAllCalled()
+	last := putUser.Last()
+	assert.Equal(t, map[string]string{"id": "1"}, last.Params)
+	last.AssertHeader("X-API-Key", "key")
+	last.AssertJSON(`{"id":"","name":"Bob"}`)
+	assert.Len(t, srv.Requests(), 2)
+}
+func TestServer_queue(t *testing.T) {
+	srv := httputiltest.NewServer(t)
+	route := srv.On(http.MethodGet, "/ref").Respond(
+		httputiltest.TooManyRequests(0),
+		httputiltest.Status(http.StatusServiceUnavailable).WithHeader("X-Foo", "bar"),
+		httputiltest.JSON(http.StatusOK, user{ID: "1"}).WithDelay(10*time.Millisecond),
+	)
+	client := srv.Client()
+	for _, want := range []int{429, 503, 200, 200} {
+		req, err := client.Request(ctx, http.MethodGet, "/ref", nil, nil)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, want, res.StatusCode)
+		if want == 429 {
+			assert.Equal(t, "0", res.Header.Get(httputil.HeaderRetryAfter))
+		}
+		if want == 503 {
+			assert.Equal(t, "bar", res.Header.Get("X-Foo"))
+		}
+	}
+	route.AssertCalls(4)
+}
+func TestServer_failures(t *testing.T) {
+	var (
+		rec    = &recordingT{TB: t}
+		srv    = httputiltest.NewServer(rec)
+		route  = srv.On(http.MethodPost, "/users")
+		client = srv.Client()
+	)
+	res, err := client.DoReq(ctx, http.MethodGet, userReq{id: "1"}, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	assert.False(t, route.AssertCalls(1))
+	assert.False(t, srv.AssertAllCalled())
+	assert.Len(t, rec.errors, 3)
+}
+
+type userReq struct {
+	id   string
+	body any
+}
+
+func (r userReq) Path() httputil.Path { return httputil.NewPath("/users/:id").WithParam("id", r.id) }
+func (r userReq) Header() http.Header { return nil }
+func (r userReq) Validate() error     { return nil }
+func (r userReq) Body() any           { return r.body }
+
+// recordingT records errors instead of failing the test
+type recordingT struct {
+	testing.TB
+	mu     sync.Mutex
+	errors []string
+}
+
+func (r *recordingT) Helper() {}
+func (r *recordingT) Errorf(format string, args ...any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
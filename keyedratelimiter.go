@@ -0,0 +1,153 @@
+package httputil
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+type (
+	// KeyedRateLimiter keeps a RateLimiter per key, such as per host, endpoint or tenant
+	// limiters are created on first use and evicted once they have been idle, see KeyedIdleTimeout
+	// set it with Client.WithKeyedRateLimiter and it is used instead of Client.RateLimiter
+	// a nil KeyedRateLimiter limits nothing and clones of the client wait on the same limiters
+	KeyedRateLimiter struct {
+		key        RateLimitKeyFunc
+		newLimiter func(key string) *RateLimiter
+		configs    map[string]func() *RateLimiter
+		idle       time.Duration
+		mu         sync.Mutex
+		limiters   map[string]*keyedLimiter
+		swept      time.Time
+	}
+	KeyedRateLimitOption = func(*KeyedRateLimiter)
+	// RateLimitKeyFunc picks the key of the limiter a request waits on
+	RateLimitKeyFunc = func(req *http.Request) string
+
+	keyedLimiter struct {
+		limiter *RateLimiter
+		used    time.Time
+	}
+)
+
+const DefaultKeyedIdleTimeout = 10 * time.Minute
+
+// NewKeyedRateLimiter creates the limiter of a key with newLimiter unless KeyedLimit configured that key
+// a nil limiter, from either, does not limit that key at all
+func NewKeyedRateLimiter(key RateLimitKeyFunc, newLimiter func(key string) *RateLimiter, options ...KeyedRateLimitOption) *KeyedRateLimiter {
+	k := &KeyedRateLimiter{
+		key:        key,
+		newLimiter: newLimiter,
+		configs:    make(map[string]func() *RateLimiter),
+		idle:       DefaultKeyedIdleTimeout,
+		limiters:   make(map[string]*keyedLimiter),
+	}
+	for _, option := range options {
+		option(k)
+	}
+	return k
+}
+
+// KeyedLimit configures the limiter of one key, such as NewRateLimiter(2) for "/search"
+func KeyedLimit(key string, newLimiter func() *RateLimiter) KeyedRateLimitOption {
+	return func(k *KeyedRateLimiter) { k.configs[key] = newLimiter }
+}
+
+// KeyedIdleTimeout evicts the limiter of a key once it was not used for d, 0 never evicts
+// an evicted limiter is saved first when it has a RateLimitPersist store
+// limiters which are paused or have used some of a quota window are not evicted
+func KeyedIdleTimeout(d time.Duration) KeyedRateLimitOption {
+	return func(k *KeyedRateLimiter) { k.idle = d }
+}
+
+// KeyByHost keys requests by the host they are sent to
+func KeyByHost() RateLimitKeyFunc {
+	return func(req *http.Request) string { return req.URL.Host }
+}
+
+// KeyByPath keys requests by the first of paths whose template and prefix match the request path
+// so NewPath("/orders/:id") is the key of every order, requests which match none have the key ""
+func KeyByPath(paths ...Path) RateLimitKeyFunc {
+	return func(req *http.Request) string {
+		for _, p := range paths {
+			if _, ok := p.Match(req.URL.Path); ok {
+				return p.path()
+			}
+		}
+		return ""
+	}
+}
+
+// KeyByHeader keys requests by the value of a header, such as the API key of a tenant
+func KeyByHeader(name string) RateLimitKeyFunc {
+	return func(req *http.Request) string { return req.Header.Get(name) }
+}
+
+// For returns the limiter for req
+func (k *KeyedRateLimiter) For(req *http.Request) *RateLimiter {
+	if k == nil {
+		return nil
+	}
+	return k.Limiter(k.key(req))
+}
+
+// Limiter returns the limiter of key, creating it when it does not exist yet
+func (k *KeyedRateLimiter) Limiter(key string) *RateLimiter {
+	if k == nil {
+		return nil
+	}
+	k.mu.Lock()
+	now := time.Now()
+	evicted := k.sweep(now)
+	l, ok := k.limiters[key]
+	if !ok {
+		l = &keyedLimiter{limiter: k.create(key)}
+		k.limiters[key] = l
+	}
+	l.used = now
+	k.mu.Unlock()
+
+	// saved after unlocking since it may do file IO
+	for _, limiter := range evicted {
+		_ = limiter.Save()
+	}
+	return l.limiter
+}
+
+// Len is the number of limiters which have not been evicted
+func (k *KeyedRateLimiter) Len() int {
+	if k == nil {
+		return 0
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.limiters)
+}
+
+func (k *KeyedRateLimiter) create(key string) *RateLimiter {
+	if newLimiter, ok := k.configs[key]; ok {
+		return newLimiter()
+	}
+	if k.newLimiter == nil {
+		return nil
+	}
+	return k.newLimiter(key)
+}
+
+// sweep evicts the idle limiters, at most once per idle timeout, and returns them so they can be saved
+// a limiter which is paused or has used some of a quota window is kept, since a new one would start fresh
+// the caller must hold mu
+func (k *KeyedRateLimiter) sweep(now time.Time) []*RateLimiter {
+	if k.idle <= 0 || now.Sub(k.swept) < k.idle {
+		return nil
+	}
+	k.swept = now
+	var evicted []*RateLimiter
+	for key, l := range k.limiters {
+		if now.Sub(l.used) >= k.idle && !l.limiter.holdsState(now) {
+			evicted = append(evicted, l.limiter)
+			delete(k.limiters, key)
+		}
+	}
+	return evicted
+}
@@ -0,0 +1,119 @@
+package httputil_test
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestKeyedRateLimiter(t *testing.T) {
+	newLimiter := func(string) *httputil.RateLimiter { return httputil.NewRateLimiter(100) }
+	newReq := func(t *testing.T, uri string) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, uri, nil)
+		require.NoError(t, err)
+		req.Header.Set("X-Tenant", "acme")
+		return req
+	}
+
+	t.Run("keys", func(t *testing.T) {
+		var (
+			req   = newReq(t, "https://example.com/v1/orders/42")
+			tests = map[string]struct {
+				key  httputil.RateLimitKeyFunc
+				want string
+			}{
+				"host":       {httputil.KeyByHost(), "example.com"},
+				"path":       {httputil.KeyByPath(httputil.NewPath("/search"), httputil.NewPath("/orders/:id").WithPrefix("v1")), "/v1/orders/:id"},
+				"path none":  {httputil.KeyByPath(httputil.NewPath("/orders/:id")), ""},
+				"header":     {httputil.KeyByHeader("X-Tenant"), "acme"},
+				"no header":  {httputil.KeyByHeader("X-Other"), ""},
+				"path param": {httputil.KeyByPath(httputil.NewPath("/v1/orders/:id").WithParam(":id", "42")), "/v1/orders/42"},
+			}
+		)
+		for name, tc := range tests {
+			t.Run(name, func(t *testing.T) {
+				assert.Equal(t, tc.want, tc.key(req))
+			})
+		}
+	})
+	t.Run("lazy per key", func(t *testing.T) {
+		keyed := httputil.NewKeyedRateLimiter(httputil.KeyByHost(), newLimiter,
+			httputil.KeyedLimit("slow.com", func() *httputil.RateLimiter { return httputil.NewRateLimiter(2) }),
+			httputil.KeyedLimit("free.com", func() *httputil.RateLimiter { return nil }),
+		)
+		assert.Equal(t, 0, keyed.Len())
+
+		slow := keyed.For(newReq(t, "https://slow.com/a"))
+		assert.Equal(t, 2.0, slow.Limit())
+		assert.Same(t, slow, keyed.For(newReq(t, "https://slow.com/b")))
+		assert.Equal(t, 100.0, keyed.For(newReq(t, "https://example.com/a")).Limit())
+		assert.Nil(t, keyed.Limiter("free.com"))
+		assert.Equal(t, 3, keyed.Len())
+	})
+	t.Run("evict idle", func(t *testing.T) {
+		store := &memRateLimitStore{}
+		keyed := httputil.NewKeyedRateLimiter(httputil.KeyByHost(), func(string) *httputil.RateLimiter {
+			return httputil.NewRateLimiter(100, httputil.RateLimitPersist(store, time.Hour))
+		}, httputil.KeyedIdleTimeout(20*time.Millisecond))
+
+		a := keyed.Limiter("a")
+		time.Sleep(30 * time.Millisecond)
+		keyed.Limiter("b")
+		assert.Equal(t, 1, keyed.Len())
+		assert.True(t, store.ok, "saved when evicted")
+		assert.NotSame(t, a, keyed.Limiter("a"))
+	})
+	t.Run("keep state", func(t *testing.T) {
+		keyed := httputil.NewKeyedRateLimiter(httputil.KeyByHost(), func(string) *httputil.RateLimiter {
+			return httputil.NewRateLimiter(100, httputil.RateLimitWindow(2, 24*time.Hour), httputil.RateLimitFromHeaders())
+		}, httputil.KeyedIdleTimeout(20*time.Millisecond))
+
+		quota := keyed.Limiter("quota")
+		require.NoError(t, quota.Wait(ctx))
+		require.NoError(t, quota.Wait(ctx))
+		paused := keyed.Limiter("paused")
+		paused.Observe(&http.Response{Header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"60"}}})
+		keyed.Limiter("idle")
+
+		time.Sleep(30 * time.Millisecond)
+		keyed.Limiter("other")
+		assert.Equal(t, 3, keyed.Len(), "only idle is evicted")
+		assert.Same(t, quota, keyed.Limiter("quota"))
+		assert.Equal(t, 0, keyed.Limiter("quota").Remaining()[0].Remaining)
+		assert.Same(t, paused, keyed.Limiter("paused"))
+	})
+	t.Run("nil safe", func(t *testing.T) {
+		var keyed *httputil.KeyedRateLimiter
+		assert.Nil(t, keyed.For(newReq(t, "https://example.com")))
+		assert.Equal(t, 0, keyed.Len())
+	})
+	t.Run("client", func(t *testing.T) {
+		var ordersCtr atomic.Int32
+		keyed := httputil.NewKeyedRateLimiter(httputil.KeyByPath(httputil.NewPath("/orders"), httputil.NewPath("/search")), newLimiter)
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/orders" && ordersCtr.Add(1) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}).
+			WithRateLimiter(httputil.NewRateLimiter(100)).
+			WithKeyedRateLimiter(keyed)
+
+		for _, path := range []string{"/orders", "/search"} {
+			req, err := client.Request(ctx, http.MethodGet, path, nil, nil)
+			require.NoError(t, err)
+			res, err := client.Do(req)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+		assertCloseEnough(t, 90, keyed.Limiter("/orders").Limit())
+		assertCloseEnough(t, 100, keyed.Limiter("/search").Limit())
+		assertCloseEnough(t, 100, client.RateLimiter.Limit()) // the single limiter is not used
+	})
+}
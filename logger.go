@@ -1,7 +1,21 @@
 package httputil
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
 	"log/slog"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	DefaultLogBodyLimit = 1024
 )
 
 type (
@@ -10,10 +24,34 @@ type (
 		Warn(msg string, args ...any)
 		Error(msg string, args ...any)
 	}
+	// ContextLogger is used instead of LevelLogger when the logger also implements it, as *slog.Logger does
+	// it is given the request context, so handlers can add trace ids from it, and req and res are
+	// logged as slog groups rather than maps
+	ContextLogger interface {
+		DebugContext(ctx context.Context, msg string, args ...any)
+		InfoContext(ctx context.Context, msg string, args ...any)
+		WarnContext(ctx context.Context, msg string, args ...any)
+		ErrorContext(ctx context.Context, msg string, args ...any)
+	}
 	sLogger struct {
 		logger LevelLogger
 	}
 	fMap = map[string]any
+
+	// LogConfig sets what the RQ/RS log line of each attempt includes
+	// the fields are req (method, host, path, header, query and body), res (status, header and body),
+	// attempt, retryReason, elapsed, rateLimitWait, requestId and error
+	// bodies up to the limit are logged as body, longer ones are cut and logged as head
+	LogConfig struct {
+		ReqBodyLimit int      // bytes of the request body to log, 0 for DefaultLogBodyLimit and < 0 to leave it out
+		ResBodyLimit int      // bytes of the response body to log, 0 for DefaultLogBodyLimit and < 0 to leave it out
+		Omit         []string // fields to leave out such as "elapsed" or "req.header"
+		DebugBodies  bool     // log the bodies of successful calls in a separate Debug line, needs a ContextLogger
+	}
+	rqrsTiming struct {
+		wait    time.Duration // waiting on the RateLimiter
+		elapsed time.Duration // from sending the request until the response headers arrived
+	}
 )
 
 func newLogger(l LevelLogger) sLogger {
@@ -25,14 +63,50 @@ func (l sLogger) log() LevelLogger {
 	}
 	return slog.Default()
 }
-func (l sLogger) Info(msg string, fields ...fMap) {
-	l.log().Info(msg, logArgs(fields...)...)
+func (l sLogger) Debug(ctx context.Context, msg string, fields ...fMap) {
+	l.Log(ctx, slog.LevelDebug, msg, fields...)
 }
-func (l sLogger) Warn(msg string, fields ...fMap) {
-	l.log().Warn(msg, logArgs(fields...)...)
+
+// Log writes at the nearest level the logger has, a LevelLogger has no Debug so those are dropped
+func (l sLogger) Log(ctx context.Context, level slog.Level, msg string, fields ...fMap) {
+	logger := l.log()
+	if cl, ok := logger.(ContextLogger); ok {
+		args := attrArgs(fields...)
+		switch {
+		case level >= slog.LevelError:
+			cl.ErrorContext(ctx, msg, args...)
+		case level >= slog.LevelWarn:
+			cl.WarnContext(ctx, msg, args...)
+		case level >= slog.LevelInfo:
+			cl.InfoContext(ctx, msg, args...)
+		default:
+			cl.DebugContext(ctx, msg, args...)
+		}
+		return
+	}
+	args := logArgs(fields...)
+	switch {
+	case level >= slog.LevelError:
+		logger.Error(msg, args...)
+	case level >= slog.LevelWarn:
+		logger.Warn(msg, args...)
+	case level >= slog.LevelInfo:
+		logger.Info(msg, args...)
+	}
 }
-func (l sLogger) Error(msg string, fields ...fMap) {
-	l.log().Error(msg, logArgs(fields...)...)
+
+// DebugEnabled reports if Debug lines would be written, so they need not be built when not
+func (l sLogger) DebugEnabled(ctx context.Context) bool {
+	logger := l.log()
+	if _, ok := logger.(ContextLogger); !ok {
+		return false
+	}
+	if e, ok := logger.(interface {
+		Enabled(context.Context, slog.Level) bool
+	}); ok {
+		return e.Enabled(ctx, slog.LevelDebug)
+	}
+	return true
 }
 func logArgs(fields ...fMap) []any {
 	var args []any
@@ -43,3 +117,122 @@ func logArgs(fields ...fMap) []any {
 	}
 	return args
 }
+
+// attrArgs turns fields into slog attributes sorted by key, nested maps become groups
+func attrArgs(fields ...fMap) []any {
+	var args []any
+	for _, f := range fields {
+		for _, attr := range attrs(f) {
+			args = append(args, attr)
+		}
+	}
+	return args
+}
+func attrs(f fMap) []slog.Attr {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	out := make([]slog.Attr, 0, len(keys))
+	for _, k := range keys {
+		if m, ok := f[k].(fMap); ok {
+			out = append(out, slog.Attr{Key: k, Value: slog.GroupValue(attrs(m)...)})
+			continue
+		}
+		out = append(out, slog.Any(k, f[k]))
+	}
+	return out
+}
+
+func (lc LogConfig) reqBodyLimit() int { return bodyLimit(lc.ReqBodyLimit) }
+func (lc LogConfig) resBodyLimit() int { return bodyLimit(lc.ResBodyLimit) }
+func bodyLimit(v int) int {
+	if v == 0 {
+		return DefaultLogBodyLimit
+	}
+	return v
+}
+
+// omit removes the Omit fields, nested maps are copied before a field is removed from them
+func (lc LogConfig) omit(fields fMap) fMap {
+	for _, name := range lc.Omit {
+		parent, child, nested := strings.Cut(name, ".")
+		if !nested {
+			delete(fields, name)
+			continue
+		}
+		if m, ok := fields[parent].(fMap); ok {
+			m2 := make(fMap, len(m))
+			for k, v := range m {
+				if k != child {
+					m2[k] = v
+				}
+			}
+			fields[parent] = m2
+		}
+	}
+	return fields
+}
+
+// logBody adds b to fields, redacted, as body when it is shorter than limit and else as head cut at limit
+// JSON is logged as the decoded value, other text as a string and binary not at all
+// JSON which was cut before it got here can't be decoded, so its head is masked by key instead
+func (c Client) logBody(fields fMap, h http.Header, b []byte, limit int) {
+	if limit < 0 || len(b) == 0 || !utf8.Valid(b) {
+		return
+	}
+	var (
+		v               any
+		mediaType, _, _ = mime.ParseMediaType(h.Get(HeaderContentType))
+	)
+	if mediaType == ApplicationForm {
+		b = []byte(c.Redaction.form(string(b)))
+	} else if err := json.Unmarshal(b, &v); err == nil {
+		c.Redaction.body(v)
+		if len(b) < limit {
+			fields["body"] = v
+			return
+		}
+		if b, err = json.Marshal(v); err != nil {
+			return
+		}
+	} else if len(b) < limit {
+		fields["body"] = string(b)
+		return
+	} else if strings.HasSuffix(mediaType, "json") || bytes.IndexAny(bytes.TrimSpace(b), "{[") == 0 {
+		fields["head"] = c.Redaction.jsonHead(string(b[:limit]))
+		return
+	}
+	fields["head"] = string(b[:min(len(b), limit)])
+}
+
+// reqBody reads a copy of the request body using GetBody, at most one byte past limit so logBody
+// can tell it was cut, multipart bodies are not read since they can be large and are streamed from their source
+func reqBody(req *http.Request, limit int) []byte {
+	if limit < 0 || req.GetBody == nil || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	if mediaType, _, _ := mime.ParseMediaType(req.Header.Get(HeaderContentType)); strings.HasPrefix(mediaType, "multipart/") {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer func() { _ = body.Close() }()
+	b, _ := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	return b
+}
+
+// takeBody moves body and head out of fields into a map of their own
+func takeBody(fields fMap) fMap {
+	out := fMap{}
+	for _, k := range []string{"body", "head"} {
+		if v, ok := fields[k]; ok {
+			out[k] = v
+			delete(fields, k)
+		}
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+package httputil_test
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_logRqRs(t *testing.T) {
+	type body struct {
+		Name     string `json:"name"`
+		Password string `json:"password"`
+	}
+	newClient := func(t *testing.T, buf *bytes.Buffer) httputil.Client {
+		var callCtr atomic.Int32
+		return clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if callCtr.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Header().Set(httputil.HeaderReqID, "req-1")
+			writeJSON(w, ResModel{ID: "1", Name: "Robert"})
+		}).
+			WithLogger(slog.New(slog.NewJSONHandler(buf, nil))).
+			WithRetryPolicy(httputil.NewRetryPolicy(1, httputil.RetryDelay(time.Millisecond, time.Millisecond)))
+	}
+	put := func(t *testing.T, client httputil.Client) {
+		req, err := client.Request(ctx, http.MethodPut, "/ref", nil, body{Name: "Robert", Password: "s3cr3t"})
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	t.Run("metadata", func(t *testing.T) {
+		var buf bytes.Buffer
+		put(t, newClient(t, &buf))
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+
+		first, second := lines[0], lines[1]
+		assert.Equal(t, float64(1), first["attempt"])
+		assert.NotContains(t, first, "retryReason")
+		assert.Equal(t, float64(2), second["attempt"])
+		assert.Equal(t, "status 503 Service Unavailable", second["retryReason"])
+		assert.Equal(t, "req-1", second["requestId"])
+		assert.Contains(t, second, "elapsed")
+		assert.Contains(t, second, "rateLimitWait")
+
+		req := second["req"].(map[string]any)
+		assert.NotEmpty(t, req["host"])
+		assert.Equal(t, map[string]any{"name": "Robert", "password": httputil.Redacted}, req["body"])
+		res := second["res"].(map[string]any)
+		assert.Equal(t, map[string]any{"id": "1", "name": "Robert"}, res["body"])
+	})
+	t.Run("config", func(t *testing.T) {
+		var buf bytes.Buffer
+		put(t, newClient(t, &buf).WithLogConfig(httputil.LogConfig{
+			ReqBodyLimit: 10,
+			ResBodyLimit: -1,
+			Omit:         []string{"elapsed", "req.header"},
+		}))
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+
+		line := lines[1]
+		assert.NotContains(t, line, "elapsed")
+		req := line["req"].(map[string]any)
+		assert.NotContains(t, req, "header")
+		assert.NotContains(t, req, "body")
+		assert.Equal(t, `{"name":"R`, req["head"])
+		res := line["res"].(map[string]any)
+		assert.NotContains(t, res, "body")
+		assert.NotContains(t, res, "head")
+	})
+	t.Run("cut body redacted", func(t *testing.T) {
+		var buf bytes.Buffer
+		put(t, newClient(t, &buf).WithLogConfig(httputil.LogConfig{ReqBodyLimit: 30}))
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+
+		req := lines[1]["req"].(map[string]any)
+		assert.Equal(t, `{"name":"Robert","password":"`+httputil.Redacted+`"`, req["head"])
+	})
+	t.Run("body not read when left out", func(t *testing.T) {
+		var (
+			buf      bytes.Buffer
+			reads    atomic.Int32
+			client   = newClient(t, &buf).WithLogConfig(httputil.LogConfig{ReqBodyLimit: -1})
+			req, err = client.Request(ctx, http.MethodPut, "/ref", nil, body{Name: "Robert"})
+		)
+		require.NoError(t, err)
+		getBody := req.GetBody
+		req.GetBody = func() (io.ReadCloser, error) {
+			reads.Add(1)
+			return getBody()
+		}
+		_, err = client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, int32(1), reads.Load(), "only to resend it on the retry")
+	})
+}
+
+func TestClient_WithLogger_context(t *testing.T) {
+	type traceKey struct{}
+	newClient := func(t *testing.T, logger httputil.LevelLogger) httputil.Client {
+		return clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			writeJSON(w, ResModel{ID: "1"})
+		}).WithLogger(logger)
+	}
+	get := func(t *testing.T, client httputil.Client) {
+		req, err := client.Request(context.WithValue(ctx, traceKey{}, "trace-1"), http.MethodGet, "/ref", nil, nil)
+		require.NoError(t, err)
+		_, err = client.Do(req)
+		require.NoError(t, err)
+	}
+
+	t.Run("context and groups", func(t *testing.T) {
+		var buf bytes.Buffer
+		handler := traceHandler{Handler: slog.NewJSONHandler(&buf, nil), key: traceKey{}}
+		get(t, newClient(t, slog.New(handler)))
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 1)
+		assert.Equal(t, "trace-1", lines[0]["trace"])
+		assert.Equal(t, "/ref", lines[0]["req"].(map[string]any)["path"])
+		assert.Equal(t, "200 OK", lines[0]["res"].(map[string]any)["status"])
+	})
+	t.Run("debug bodies", func(t *testing.T) {
+		var (
+			buf    bytes.Buffer
+			logger = slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		)
+		get(t, newClient(t, logger).WithLogConfig(httputil.LogConfig{DebugBodies: true}))
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "INFO", lines[0]["level"])
+		assert.NotContains(t, lines[0]["res"], "body")
+		assert.Equal(t, "DEBUG", lines[1]["level"])
+		assert.Equal(t, map[string]any{"id": "1", "name": ""}, lines[1]["res"].(map[string]any)["body"])
+	})
+	t.Run("debug disabled", func(t *testing.T) {
+		var buf bytes.Buffer
+		get(t, newClient(t, slog.New(slog.NewJSONHandler(&buf, nil))).WithLogConfig(httputil.LogConfig{DebugBodies: true}))
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 1)
+		assert.NotContains(t, lines[0]["res"], "body")
+	})
+	t.Run("level logger", func(t *testing.T) {
+		var logger levelLogger
+		get(t, newClient(t, &logger))
+		require.Len(t, logger.lines, 1)
+		assert.Contains(t, logger.lines[0], "[RQ/RS] GET /ref 200 OK")
+	})
+}
+
+type traceHandler struct {
+	slog.Handler
+	key any
+}
+
+func (h traceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if v, ok := ctx.Value(h.key).(string); ok {
+		r.AddAttrs(slog.String("trace", v))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+// levelLogger only implements LevelLogger and not ContextLogger
+type levelLogger struct {
+	lines []string
+}
+
+func (l *levelLogger) Info(msg string, args ...any)  { l.lines = append(l.lines, "INFO "+msg) }
+func (l *levelLogger) Warn(msg string, args ...any)  { l.lines = append(l.lines, "WARN "+msg) }
+func (l *levelLogger) Error(msg string, args ...any) { l.lines = append(l.lines, "ERROR "+msg) }
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	t.Helper()
+	var lines []map[string]any
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var line map[string]any
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+		lines = append(lines, line)
+	}
+	return lines
+}
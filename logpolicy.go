@@ -0,0 +1,114 @@
+package httputil
+
+import (
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+type (
+	// LogPolicy decides which RQ/RS lines are written and at what level, while LogConfig sets what they include
+	// failures, a transport error or a status >= 400, are never sampled and neither are slow calls
+	// a nil LogPolicy logs every call at the default levels, clones of the client share its
+	// sample counter and the errors it is deduping
+	LogPolicy struct {
+		levels        map[int]slog.Level // by status class, 2 for 2xx and so on
+		sampleSuccess int64
+		slowThreshold time.Duration
+		dedupeErrors  time.Duration
+
+		successes atomic.Int64
+		mu        sync.Mutex
+		errLines  map[string]*errLine
+	}
+	LogOption = func(*LogPolicy)
+
+	errLine struct {
+		logged     time.Time
+		suppressed int
+	}
+)
+
+func NewLogPolicy(options ...LogOption) *LogPolicy {
+	p := &LogPolicy{
+		levels:   make(map[int]slog.Level),
+		errLines: make(map[string]*errLine),
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// LogLevel sets the level for a status class, 2 for 2xx up to 5 for 5xx
+// by default 2xx and 3xx are logged at Info and 4xx and 5xx at Warn, transport errors are always Error
+func LogLevel(statusClass int, level slog.Level) LogOption {
+	return func(p *LogPolicy) { p.levels[statusClass] = level }
+}
+
+// LogSampleSuccess only logs 1 in n successful calls, the first one included
+func LogSampleSuccess(n int) LogOption {
+	return func(p *LogPolicy) { p.sampleSuccess = int64(n) }
+}
+
+// LogSlowThreshold always logs calls which took longer than d, even when successes are sampled
+func LogSlowThreshold(d time.Duration) LogOption {
+	return func(p *LogPolicy) { p.slowThreshold = d }
+}
+
+// LogDedupeErrors writes identical failure lines at most once per interval
+// the next one written after that has a suppressed field with the count of those which were not
+func LogDedupeErrors(interval time.Duration) LogOption {
+	return func(p *LogPolicy) { p.dedupeErrors = interval }
+}
+
+// level returns the level to log the call at and false when it should not be logged
+func (p *LogPolicy) level(res *http.Response, err error, elapsed time.Duration) (slog.Level, bool) {
+	if err != nil || res == nil {
+		return slog.LevelError, true
+	}
+	level := slog.LevelInfo
+	if res.StatusCode >= 400 {
+		level = slog.LevelWarn
+	}
+	if p == nil {
+		return level, true
+	}
+	if l, ok := p.levels[res.StatusCode/100]; ok {
+		level = l
+	}
+	if res.StatusCode >= 400 || p.sampleSuccess <= 1 || (p.slowThreshold > 0 && elapsed > p.slowThreshold) {
+		return level, true
+	}
+	return level, (p.successes.Add(1)-1)%p.sampleSuccess == 0
+}
+
+// dedupe returns false when an identical failure line was written less than the interval ago
+// and otherwise how many were suppressed since the last one which was written
+func (p *LogPolicy) dedupe(line string) (int, bool) {
+	if p == nil || p.dedupeErrors <= 0 {
+		return 0, true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for k, e := range p.errLines {
+		if now.Sub(e.logged) >= p.dedupeErrors && e.suppressed == 0 {
+			delete(p.errLines, k) // expired and nothing to report, keeps the map small
+		}
+	}
+	e, ok := p.errLines[line]
+	if !ok {
+		p.errLines[line] = &errLine{logged: now}
+		return 0, true
+	}
+	if now.Sub(e.logged) < p.dedupeErrors {
+		e.suppressed++
+		return 0, false
+	}
+	suppressed := e.suppressed
+	e.logged, e.suppressed = now, 0
+	return suppressed, true
+}
@@ -0,0 +1,108 @@
+package httputil_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_WithLogPolicy(t *testing.T) {
+	var (
+		status atomic.Int32
+		delay  atomic.Int64
+	)
+	newClient := func(t *testing.T, buf *bytes.Buffer, policy *httputil.LogPolicy) httputil.Client {
+		status.Store(http.StatusOK)
+		delay.Store(0)
+		return clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Duration(delay.Load()))
+			w.WriteHeader(int(status.Load()))
+		}).
+			WithLogger(slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))).
+			WithRetryPolicy(nil).
+			WithLogPolicy(policy)
+	}
+	get := func(t *testing.T, client httputil.Client, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			req, err := client.Request(ctx, http.MethodGet, "/ref", nil, nil)
+			require.NoError(t, err)
+			_, err = client.Do(req)
+			require.NoError(t, err)
+		}
+	}
+
+	t.Run("default", func(t *testing.T) {
+		var buf bytes.Buffer
+		client := newClient(t, &buf, nil)
+		get(t, client, 2)
+		status.Store(http.StatusNotFound)
+		get(t, client, 1)
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 3)
+		assert.Equal(t, "INFO", lines[0]["level"])
+		assert.Equal(t, "WARN", lines[2]["level"])
+	})
+	t.Run("levels", func(t *testing.T) {
+		var buf bytes.Buffer
+		client := newClient(t, &buf, httputil.NewLogPolicy(
+			httputil.LogLevel(2, slog.LevelDebug),
+			httputil.LogLevel(4, slog.LevelError),
+		))
+		get(t, client, 1)
+		status.Store(http.StatusBadRequest)
+		get(t, client, 1)
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "DEBUG", lines[0]["level"])
+		assert.Equal(t, "ERROR", lines[1]["level"])
+	})
+	t.Run("sample successes", func(t *testing.T) {
+		var buf bytes.Buffer
+		client := newClient(t, &buf, httputil.NewLogPolicy(
+			httputil.LogSampleSuccess(3),
+			httputil.LogSlowThreshold(20*time.Millisecond),
+		))
+		get(t, client, 6)
+		assert.Len(t, logLines(t, &buf), 2, "1 in 3")
+
+		status.Store(http.StatusInternalServerError)
+		get(t, client, 2)
+		assert.Len(t, logLines(t, &buf), 2, "failures are never sampled")
+
+		status.Store(http.StatusOK)
+		delay.Store(int64(30 * time.Millisecond))
+		get(t, client, 2)
+		assert.Len(t, logLines(t, &buf), 2, "slow calls are never sampled")
+	})
+	t.Run("dedupe errors", func(t *testing.T) {
+		var (
+			buf      bytes.Buffer
+			interval = 50 * time.Millisecond
+			client   = newClient(t, &buf, httputil.NewLogPolicy(httputil.LogDedupeErrors(interval)))
+		)
+		status.Store(http.StatusServiceUnavailable)
+		get(t, client, 3)
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 1)
+		assert.NotContains(t, lines[0], "suppressed")
+
+		status.Store(http.StatusBadGateway)
+		get(t, client, 1)
+		assert.Len(t, logLines(t, &buf), 1, "a different line")
+
+		time.Sleep(interval)
+		status.Store(http.StatusServiceUnavailable)
+		get(t, client, 1)
+		lines = logLines(t, &buf)
+		require.Len(t, lines, 1)
+		assert.Equal(t, float64(2), lines[0]["suppressed"])
+	})
+}
@@ -0,0 +1,25 @@
+package httputil
+
+import (
+	"net/http"
+)
+
+type (
+	RoundTripFunc func(req *http.Request) (*http.Response, error)
+
+	// Middleware wraps every attempt made by Client.Do, so it runs once per retry
+	// and not once per logical call.  next waits on the RateLimiter, adds the client
+	// headers, calls HttpClient.Do and logs the RQ/RS, so a middleware sees the request
+	// before any of that happens and the response after all of it has happened
+	// the first Middleware added is the outermost
+	Middleware func(next RoundTripFunc) RoundTripFunc
+)
+
+// roundTrip wraps c.do in the middleware chain, the first Middleware is called first
+func (c Client) roundTrip() RoundTripFunc {
+	next := RoundTripFunc(c.do)
+	for i := len(c.Middleware) - 1; i >= 0; i-- {
+		next = c.Middleware[i](next)
+	}
+	return next
+}
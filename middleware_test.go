@@ -0,0 +1,61 @@
+package httputil_test
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_WithMiddleware(t *testing.T) {
+	var (
+		order   []string
+		callCtr = atomic.Int32{}
+		tag     = func(name string) httputil.Middleware {
+			return func(next httputil.RoundTripFunc) httputil.RoundTripFunc {
+				return func(req *http.Request) (*http.Response, error) {
+					order = append(order, name+":before")
+					req.Header.Set("X-"+name, name)
+					res, err := next(req)
+					order = append(order, name+":after")
+					return res, err
+				}
+			}
+		}
+	)
+	client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "a", r.Header.Get("X-a"))
+		assert.Equal(t, "b", r.Header.Get("X-b"))
+		if callCtr.Add(1) == 1 {
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).With429Retry(1).WithMiddleware(tag("a"), tag("b"))
+
+	req, err := client.Request(ctx, http.MethodGet, "/", nil, nil)
+	require.NoError(t, err)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	// first added is outermost and the chain runs once per attempt
+	attempt := []string{"a:before", "b:before", "b:after", "a:after"}
+	assert.Equal(t, append(attempt, attempt...), order)
+	assert.Empty(t, req.Header.Get("X-a"), "the callers request is not changed")
+}
+func TestClient_WithMiddleware_clone(t *testing.T) {
+	var (
+		noop = func(next httputil.RoundTripFunc) httputil.RoundTripFunc { return next }
+		a    = httputil.NewClient().WithMiddleware(noop)
+		b    = a.WithMiddleware(noop)
+		c    = a.WithMiddleware(noop, noop)
+	)
+	assert.Len(t, a.Middleware, 1)
+	assert.Len(t, b.Middleware, 2)
+	assert.Len(t, c.Middleware, 3)
+	assert.Len(t, a.Clone().Middleware, 1)
+}
@@ -0,0 +1,199 @@
+package httputil
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const (
+	ApplicationOctetStream = "application/octet-stream"
+)
+
+type (
+	// Multipart is a multipart/form-data body which Client.Request streams to the server
+	// without loading files into memory, a Request model can return it from Body()
+	// it can only be resent on retry when every part can be reopened,
+	// which is true for fields, file paths and readers which are also an io.Seeker
+	Multipart struct {
+		boundary string
+		parts    []multipartPart
+	}
+	multipartPart struct {
+		header textproto.MIMEHeader
+		open   func() (io.Reader, error)
+		replay bool
+	}
+	PartOption = func(textproto.MIMEHeader)
+)
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// NewMultipart constructs a Multipart with a random boundary
+func NewMultipart() Multipart {
+	return Multipart{boundary: multipart.NewWriter(io.Discard).Boundary()}
+}
+
+// PartContentType sets the Content-Type of a part
+// file parts default to application/octet-stream and fields have none
+func PartContentType(contentType string) PartOption {
+	return func(h textproto.MIMEHeader) { h.Set(HeaderContentType, contentType) }
+}
+func PartHeader(key, value string) PartOption {
+	return func(h textproto.MIMEHeader) { h.Add(key, value) }
+}
+
+func (m Multipart) WithField(name, value string, options ...PartOption) Multipart {
+	return m.withPart(partHeader(name, "", "", options), func() (io.Reader, error) {
+		return strings.NewReader(value), nil
+	}, true)
+}
+
+// WithFile streams r as a file part
+// when r is an io.Seeker it is rewound for each retry, else it is closed after it is sent
+func (m Multipart) WithFile(field, filename string, r io.Reader, options ...PartOption) Multipart {
+	open, replay := readerPart(r)
+	return m.withPart(partHeader(field, filename, ApplicationOctetStream, options), open, replay)
+}
+
+// WithFilePath opens the file at path each time the body is sent
+// the filename defaults to the base of path
+func (m Multipart) WithFilePath(field, path string, options ...PartOption) Multipart {
+	header := partHeader(field, filepath.Base(path), ApplicationOctetStream, options)
+	return m.withPart(header, func() (io.Reader, error) {
+		return os.Open(path)
+	}, true)
+}
+
+// WithPart adds a part with a header you construct yourself
+func (m Multipart) WithPart(header textproto.MIMEHeader, r io.Reader) Multipart {
+	open, replay := readerPart(r)
+	return m.withPart(header, open, replay)
+}
+
+func (m Multipart) ContentType() string {
+	return "multipart/form-data; boundary=" + m.boundary
+}
+
+// Reader returns the encoded body, the parts are written to it as it is read
+// nothing is opened until the first Read, so a body which is never sent holds no goroutine or file
+func (m Multipart) Reader() io.ReadCloser {
+	return &multipartReader{m: m}
+}
+func (m Multipart) Replayable() bool {
+	for _, p := range m.parts {
+		if !p.replay {
+			return false
+		}
+	}
+	return true
+}
+
+func (m Multipart) withPart(header textproto.MIMEHeader, open func() (io.Reader, error), replay bool) Multipart {
+	m.parts = append(slices.Clip(m.parts), multipartPart{header: header, open: open, replay: replay})
+	return m
+}
+func (m Multipart) writeTo(w io.Writer) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(m.boundary); err != nil {
+		return err
+	}
+	for _, p := range m.parts {
+		if err := p.writeTo(mw); err != nil {
+			return err
+		}
+	}
+	return mw.Close()
+}
+func (p multipartPart) writeTo(mw *multipart.Writer) error {
+	w, err := mw.CreatePart(p.header)
+	if err != nil {
+		return err
+	}
+	r, err := p.open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", "multipart open failed", err)
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer func() { _ = c.Close() }()
+	}
+	_, err = io.Copy(w, r)
+	return err
+}
+
+// multipartReader starts writing the parts to a pipe on the first Read
+type multipartReader struct {
+	m      Multipart
+	mu     sync.Mutex
+	pr     *io.PipeReader
+	closed bool
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+	pr, err := r.pipe()
+	if err != nil {
+		return 0, err
+	}
+	return pr.Read(p)
+}
+func (r *multipartReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	if r.pr == nil {
+		return nil
+	}
+	return r.pr.Close() // the writer gets io.ErrClosedPipe and stops
+}
+func (r *multipartReader) pipe() (*io.PipeReader, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return nil, io.ErrClosedPipe
+	}
+	if r.pr == nil {
+		pr, pw := io.Pipe()
+		go func() { _ = pw.CloseWithError(r.m.writeTo(pw)) }()
+		r.pr = pr
+	}
+	return r.pr, nil
+}
+func readerPart(r io.Reader) (func() (io.Reader, error), bool) {
+	seeker, ok := r.(io.Seeker)
+	if !ok {
+		return func() (io.Reader, error) { return r, nil }, false
+	}
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return func() (io.Reader, error) { return r, nil }, false
+	}
+	return func() (io.Reader, error) {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return io.NopCloser(r), nil
+	}, true
+}
+func partHeader(name, filename, contentType string, options []PartOption) textproto.MIMEHeader {
+	var (
+		h           = make(textproto.MIMEHeader)
+		disposition = fmt.Sprintf(`form-data; name="%s"`, quoteEscaper.Replace(name))
+	)
+	if filename != "" {
+		disposition += fmt.Sprintf(`; filename="%s"`, quoteEscaper.Replace(filename))
+	}
+	h.Set("Content-Disposition", disposition)
+	if contentType != "" {
+		h.Set(HeaderContentType, contentType)
+	}
+	for _, option := range options {
+		option(h)
+	}
+	return h
+}
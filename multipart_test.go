@@ -0,0 +1,153 @@
+package httputil_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+type UploadDocReq struct {
+	httputil.ReqHeaders
+	DocID string
+	Title string
+	File  io.Reader
+}
+
+var (
+	_ httputil.Request     = (*UploadDocReq)(nil)
+	_ httputil.RequestBody = (*UploadDocReq)(nil)
+)
+
+func (r UploadDocReq) Path() httputil.Path {
+	return httputil.NewPath("/docs/:docID").WithParam("docID", r.DocID)
+}
+func (r UploadDocReq) Validate() error {
+	if r.File == nil {
+		return errors.New("missing file")
+	}
+	return nil
+}
+func (r UploadDocReq) Body() any {
+	return httputil.NewMultipart().
+		WithField("title", r.Title).
+		WithFile("doc", "doc.pdf", r.File,
+			httputil.PartContentType("application/pdf"),
+			httputil.PartHeader("X-Checksum", "abc"))
+}
+
+func TestClient_Multipart(t *testing.T) {
+	var (
+		pdf   = "%PDF-1.4 not really a pdf"
+		notes = "some notes"
+		path  = filepath.Join(t.TempDir(), "notes.txt")
+	)
+	require.NoError(t, os.WriteFile(path, []byte(notes), 0o600))
+
+	t.Run("DoReq with Body", func(t *testing.T) {
+		var (
+			callCtr = atomic.Int32{}
+			req     = UploadDocReq{DocID: "D1", Title: "Lease", File: strings.NewReader(pdf)}
+		)
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "/docs/D1", r.URL.Path)
+			if !assert.NoError(t, r.ParseMultipartForm(1<<20)) {
+				return
+			}
+			assert.Equal(t, "Lease", r.FormValue("title"))
+			f, fh, err := r.FormFile("doc")
+			if !assert.NoError(t, err) {
+				return
+			}
+			b, _ := io.ReadAll(f)
+			assert.Equal(t, pdf, string(b))
+			assert.Equal(t, "doc.pdf", fh.Filename)
+			assert.Equal(t, "application/pdf", fh.Header.Get(httputil.HeaderContentType))
+			assert.Equal(t, "abc", fh.Header.Get("X-Checksum"))
+
+			// first attempt is a 429 so the body must be streamed again
+			if callCtr.Add(1) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}).With429Retry(1)
+
+		res, err := client.DoReq(ctx, http.MethodPost, &req, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int32(2), callCtr.Load())
+	})
+	t.Run("file path", func(t *testing.T) {
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if !assert.NoError(t, r.ParseMultipartForm(1<<20)) {
+				return
+			}
+			f, fh, err := r.FormFile("notes")
+			if !assert.NoError(t, err) {
+				return
+			}
+			b, _ := io.ReadAll(f)
+			assert.Equal(t, notes, string(b))
+			assert.Equal(t, "notes.txt", fh.Filename)
+			assert.Equal(t, httputil.ApplicationOctetStream, fh.Header.Get(httputil.HeaderContentType))
+			w.WriteHeader(http.StatusOK)
+		})
+		body := httputil.NewMultipart().WithFilePath("notes", path)
+		req, err := client.Request(ctx, http.MethodPost, "/", nil, body)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	})
+	t.Run("not sent", func(t *testing.T) {
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			t.Error("nothing should be sent")
+		})
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		before := runtime.NumGoroutine()
+		for i := 0; i < 20; i++ {
+			// the rate limiter returns before the body is sent
+			req, err := client.Request(canceled, http.MethodPost, "/", nil, httputil.NewMultipart().WithFilePath("notes", path))
+			require.NoError(t, err)
+			_, err = client.Do(req)
+			require.ErrorIs(t, err, context.Canceled)
+		}
+		for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		assert.LessOrEqual(t, runtime.NumGoroutine(), before, "no goroutine is left writing the body")
+	})
+	t.Run("nil", func(t *testing.T) {
+		var body *httputil.Multipart
+		req, err := httputil.NewClient().Request(ctx, http.MethodPost, "http://example.com/", nil, body)
+		require.NoError(t, err)
+		assert.Nil(t, req.Body)
+		assert.Empty(t, req.Header.Get(httputil.HeaderContentType))
+	})
+	t.Run("not replayable", func(t *testing.T) {
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.WriteHeader(http.StatusTooManyRequests)
+		}).With429Retry(1)
+		body := httputil.NewMultipart().
+			WithFile("doc", "doc.pdf", io.MultiReader(strings.NewReader(pdf)))
+		assert.False(t, body.Replayable())
+		req, err := client.Request(ctx, http.MethodPost, "/", nil, body)
+		require.NoError(t, err)
+		_, err = client.Do(req)
+		assert.ErrorIs(t, err, httputil.ErrBodyNotReplayable)
+	})
+}
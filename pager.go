@@ -0,0 +1,190 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	HeaderLink = "Link"
+)
+
+var (
+	ErrCrossHostLink = errors.New("next link is on another host")
+)
+
+// Pager requests one page after another, decoding each into T
+// by default it follows the RFC 8288 Link header with rel="next"
+// use WithCursor when the next page is found in the decoded page instead
+// every page goes through Client.DoAndDecode so rate limiting and retries apply
+// and a status >= 400 stops the pager with an *HTTPError
+//
+//	p := httputil.NewPager[ListRes](client, http.MethodGet, &req).WithMaxPages(10)
+//	for p.Next(ctx) {
+//		use(p.Page())
+//	}
+//	if err := p.Err(); err != nil {
+//		...
+//	}
+type Pager[T any] struct {
+	client      Client
+	method      string
+	r           Request
+	cursor      func(page T) string
+	cursorParam string
+	maxPages    int
+	crossHost   bool
+
+	header http.Header // of r, taken once since Header() of ReqHeaders adds the ReqID on every call
+	pages  int
+	next   string // url of the next page, empty before the first page
+	page   T
+	res    *http.Response
+	err    error
+	done   bool
+}
+
+func NewPager[T any](c Client, method string, r Request) *Pager[T] {
+	return &Pager[T]{
+		client: c.WithStatusErrors(true),
+		method: method,
+		r:      r,
+	}
+}
+
+// WithCursor reads the cursor for the next page from the decoded page
+// and sends it in the query param, an empty cursor means there are no more pages
+func (p *Pager[T]) WithCursor(param string, next func(page T) string) *Pager[T] {
+	p.cursorParam, p.cursor = param, next
+	return p
+}
+
+// WithMaxPages stops the pager after n pages, 0 means no limit
+func (p *Pager[T]) WithMaxPages(n int) *Pager[T] {
+	p.maxPages = n
+	return p
+}
+
+// WithCrossHostLinks follows a next link to another scheme or host, which by default stops the pager
+// with ErrCrossHostLink, since the client headers and Auth credentials are sent to that host too
+func (p *Pager[T]) WithCrossHostLinks() *Pager[T] {
+	p.crossHost = true
+	return p
+}
+
+// Next requests the next page and reports if there is one to read with Page
+func (p *Pager[T]) Next(ctx context.Context) bool {
+	if p.done || p.err != nil || (p.maxPages > 0 && p.pages >= p.maxPages) {
+		return false
+	}
+	if p.pages > 0 && p.next == "" {
+		p.done = true
+		return false
+	}
+
+	req, err := p.request(ctx)
+	if err != nil {
+		p.err = err
+		return false
+	}
+
+	var page T
+	res, err := p.client.DoAndDecode(req, &page, nil)
+	if err != nil {
+		p.err = err
+		return false
+	}
+
+	p.pages++
+	p.page, p.res = page, res
+	p.next, p.err = p.nextURL(req, res, page)
+	return true
+}
+func (p *Pager[T]) Page() T                  { return p.page }
+func (p *Pager[T]) Response() *http.Response { return p.res }
+func (p *Pager[T]) Pages() int               { return p.pages }
+func (p *Pager[T]) Err() error               { return p.err }
+
+func (p *Pager[T]) request(ctx context.Context) (*http.Request, error) {
+	if p.pages == 0 {
+		p.header = p.r.Header().Clone()
+		return p.client.modelRequest(ctx, p.method, p.r, p.header)
+	}
+	return p.client.Request(ctx, p.method, p.next, p.header, requestBody(p.r))
+}
+func (p *Pager[T]) nextURL(req *http.Request, res *http.Response, page T) (string, error) {
+	if p.cursor != nil {
+		cursor := p.cursor(page)
+		if cursor == "" {
+			return "", nil
+		}
+		u := *req.URL
+		q := u.Query()
+		q.Set(p.cursorParam, cursor)
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+
+	link, ok := linkRel(res.Header, "next")
+	if !ok {
+		return "", nil
+	}
+	next, err := req.URL.Parse(link) // resolve relative links against the current page
+	if err != nil || next.String() == req.URL.String() {
+		return "", nil
+	}
+	if !p.crossHost && (next.Scheme != req.URL.Scheme || next.Host != req.URL.Host) {
+		return "", fmt.Errorf("%w: %s://%s", ErrCrossHostLink, next.Scheme, next.Host)
+	}
+	return next.String(), nil
+}
+
+// CollectPages reads every page from p and gathers the items returned by items
+// it stops once maxItems have been collected, 0 means no limit
+func CollectPages[T, I any](ctx context.Context, p *Pager[T], items func(page T) []I, maxItems int) ([]I, error) {
+	var all []I
+	for p.Next(ctx) {
+		all = append(all, items(p.Page())...)
+		if maxItems > 0 && len(all) >= maxItems {
+			return all[:maxItems], nil
+		}
+	}
+	return all, p.Err()
+}
+
+// linkRel returns the target of the first RFC 8288 link with the relation type rel
+// ex: Link: <https://api.example.com/items?page=2>; rel="next", <...>; rel="last"
+func linkRel(h http.Header, rel string) (string, bool) {
+	for _, v := range h.Values(HeaderLink) {
+		for v != "" {
+			start := strings.IndexByte(v, '<')
+			end := strings.IndexByte(v, '>')
+			if start < 0 || end < start {
+				break
+			}
+			target := v[start+1 : end]
+			params := v[end+1:]
+			if next := strings.IndexByte(params, '<'); next >= 0 {
+				params, v = params[:next], params[next:]
+			} else {
+				v = ""
+			}
+			for _, param := range strings.Split(params, ";") {
+				k, val, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(strings.TrimSpace(k), "rel") {
+					continue
+				}
+				val = strings.Trim(strings.TrimSpace(strings.TrimRight(strings.TrimSpace(val), ",")), `"`)
+				for _, r := range strings.Fields(val) {
+					if strings.EqualFold(r, rel) {
+						return target, true
+					}
+				}
+			}
+		}
+	}
+	return "", false
+}
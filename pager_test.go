@@ -0,0 +1,171 @@
+package httputil_test
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+type (
+	ListItemsReq struct {
+		httputil.ReqHeaders `json:"-"`
+		Kind                string `json:"-"`
+	}
+	ItemsPage struct {
+		Items      []int  `json:"items"`
+		NextCursor string `json:"nextCursor"`
+	}
+)
+
+func (r ListItemsReq) Path() httputil.Path {
+	return httputil.NewPath("/items").WithQuery("kind", r.Kind)
+}
+func (r ListItemsReq) Validate() error { return nil }
+
+func TestPager(t *testing.T) {
+	const pageSize, lastPage = 2, 3
+	var (
+		req      = ListItemsReq{Kind: "k"}
+		itemsFn  = func(p ItemsPage) []int { return p.Items }
+		pageItem = func(page int) []int { return []int{page*10 + 1, page*10 + 2} }
+		pageOf   = func(r *http.Request, param string) int {
+			page, _ := strconv.Atoi(r.URL.Query().Get(param))
+			return max(page, 1)
+		}
+	)
+	linkServer := func(t *testing.T, callCtr *atomic.Int32) httputil.Client {
+		return clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			callCtr.Add(1)
+			assert.Equal(t, "k", r.URL.Query().Get("kind"))
+			page := pageOf(r, "page")
+			if page < lastPage {
+				// relative link on odd pages, absolute on even
+				next := fmt.Sprintf("/items?kind=k&page=%d", page+1)
+				if page%2 == 0 {
+					next = "http://" + r.Host + next
+				}
+				w.Header().Add(httputil.HeaderLink, `<`+next+`>; rel="next", </items?page=3>; rel="last"`)
+			}
+			writeJSON(w, ItemsPage{Items: pageItem(page)})
+		})
+	}
+	t.Run("Link header", func(t *testing.T) {
+		var (
+			callCtr atomic.Int32
+			pager   = httputil.NewPager[ItemsPage](linkServer(t, &callCtr), http.MethodGet, &req)
+			pages   []ItemsPage
+		)
+		for pager.Next(ctx) {
+			pages = append(pages, pager.Page())
+		}
+		require.NoError(t, pager.Err())
+		require.Len(t, pages, lastPage)
+		assert.Equal(t, pageItem(3), pages[2].Items)
+		assert.Equal(t, int32(lastPage), callCtr.Load())
+		assert.False(t, pager.Next(ctx))
+	})
+	t.Run("headers taken once", func(t *testing.T) {
+		var (
+			mu     sync.Mutex
+			reqIDs [][]string
+			client = clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				reqIDs = append(reqIDs, r.Header.Values(httputil.HeaderReqID))
+				mu.Unlock()
+				if page := pageOf(r, "page"); page < lastPage {
+					w.Header().Add(httputil.HeaderLink, fmt.Sprintf(`</items?kind=k&page=%d>; rel="next"`, page+1))
+				}
+				writeJSON(w, ItemsPage{})
+			})
+			req   = ListItemsReq{Kind: "k", ReqHeaders: httputil.ReqHeaders{ReqID: "abc"}}
+			pager = httputil.NewPager[ItemsPage](client, http.MethodGet, &req)
+		)
+		for pager.Next(ctx) {
+		}
+		require.NoError(t, pager.Err())
+		assert.Equal(t, [][]string{{"abc"}, {"abc"}, {"abc"}}, reqIDs)
+	})
+	t.Run("cross host link", func(t *testing.T) {
+		var foreignCtr atomic.Int32
+		foreign := fakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			foreignCtr.Add(1)
+			writeJSON(w, ItemsPage{Items: pageItem(2)})
+		})
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add(httputil.HeaderLink, `<`+foreign.URL+`/items?page=2>; rel="next"`)
+			writeJSON(w, ItemsPage{Items: pageItem(1)})
+		}).WithSetHeader("X-API-Key", "s3cr3t")
+
+		pager := httputil.NewPager[ItemsPage](client, http.MethodGet, &req)
+		assert.True(t, pager.Next(ctx))
+		assert.False(t, pager.Next(ctx))
+		assert.ErrorIs(t, pager.Err(), httputil.ErrCrossHostLink)
+		assert.Equal(t, int32(0), foreignCtr.Load(), "the api key is not sent to another host")
+
+		pager = httputil.NewPager[ItemsPage](client, http.MethodGet, &req).WithCrossHostLinks().WithMaxPages(2)
+		items, err := httputil.CollectPages(ctx, pager, itemsFn, 0)
+		require.NoError(t, err)
+		assert.Equal(t, append(pageItem(1), pageItem(2)...), items)
+		assert.Equal(t, int32(1), foreignCtr.Load())
+	})
+	t.Run("max pages", func(t *testing.T) {
+		var callCtr atomic.Int32
+		pager := httputil.NewPager[ItemsPage](linkServer(t, &callCtr), http.MethodGet, &req).WithMaxPages(2)
+		items, err := httputil.CollectPages(ctx, pager, itemsFn, 0)
+		require.NoError(t, err)
+		assert.Equal(t, append(pageItem(1), pageItem(2)...), items)
+		assert.Equal(t, 2, pager.Pages())
+	})
+	t.Run("max items", func(t *testing.T) {
+		var callCtr atomic.Int32
+		pager := httputil.NewPager[ItemsPage](linkServer(t, &callCtr), http.MethodGet, &req)
+		items, err := httputil.CollectPages(ctx, pager, itemsFn, pageSize+1)
+		require.NoError(t, err)
+		assert.Equal(t, append(pageItem(1), pageItem(2)[0]), items)
+		assert.Equal(t, int32(2), callCtr.Load())
+	})
+	t.Run("cursor with retry", func(t *testing.T) {
+		var callCtr atomic.Int32
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if callCtr.Add(1) == 2 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			var (
+				page = pageOf(r, "cursor")
+				res  = ItemsPage{Items: pageItem(page)}
+			)
+			if page < lastPage {
+				res.NextCursor = strconv.Itoa(page + 1)
+			}
+			writeJSON(w, res)
+		}).With429Retry(1)
+		pager := httputil.NewPager[ItemsPage](client, http.MethodGet, &req).
+			WithCursor("cursor", func(p ItemsPage) string { return p.NextCursor })
+		items, err := httputil.CollectPages(ctx, pager, itemsFn, 0)
+		require.NoError(t, err)
+		assert.Equal(t, append(append(pageItem(1), pageItem(2)...), pageItem(3)...), items)
+		assert.Equal(t, int32(lastPage+1), callCtr.Load())
+	})
+	t.Run("error stops the pager", func(t *testing.T) {
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if pageOf(r, "page") == 2 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Header().Add(httputil.HeaderLink, `</items?page=2>; rel="next"`)
+			writeJSON(w, ItemsPage{Items: pageItem(1)})
+		})
+		pager := httputil.NewPager[ItemsPage](client, http.MethodGet, &req)
+		items, err := httputil.CollectPages(ctx, pager, itemsFn, 0)
+		assert.ErrorIs(t, err, httputil.ErrNotFound)
+		assert.Equal(t, pageItem(1), items)
+	})
+}
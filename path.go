@@ -88,6 +88,29 @@ func (p Path) WithQueryValues(query url.Values) Path {
 	return p
 }
 
+// Match reports if a url path matches the prefix and template, params which were not set match any segment
+// ex: NewPath("/supplier/:supplierID").Match("/supplier/42") returns {"supplierID": "42"}, true
+func (p Path) Match(path string) (map[string]string, bool) {
+	tmpl, _, _ := strings.Cut(p.path(), "?")
+	var (
+		want   = strings.Split(p.trim(tmpl), "/")
+		got    = strings.Split(p.trim(path), "/")
+		params = make(map[string]string)
+	)
+	if len(want) != len(got) {
+		return nil, false
+	}
+	for i, elem := range want {
+		switch {
+		case strings.HasPrefix(elem, ":") && got[i] != "":
+			params[elem[1:]] = got[i]
+		case elem != got[i]:
+			return nil, false
+		}
+	}
+	return params, true
+}
+
 func (p Path) host() string { return p.trim(p.baseURL) }
 func (p Path) path() string {
 	var (
@@ -2,6 +2,7 @@ package httputil_test
 
 import (
 	"fmt"
+	"maps"
 	"testing"
 
 	"github.com/tempcke/httputil"
@@ -112,6 +113,31 @@ func TestPath(t *testing.T) {
 		})
 	}
 }
+func TestPath_Match(t *testing.T) {
+	var tests = map[string]struct {
+		path   httputil.Path
+		uri    string
+		match  bool
+		params map[string]string
+	}{
+		"static":        {path: httputil.NewPath("/foo"), uri: "/foo/", match: true, params: map[string]string{}},
+		"param":         {path: httputil.NewPath("/foo/:foo/baz"), uri: "/foo/bar/baz", match: true, params: map[string]string{"foo": "bar"}},
+		"prefix":        {path: httputil.NewPath("/foo/:foo").WithPrefix("v1"), uri: "/v1/foo/bar", match: true, params: map[string]string{"foo": "bar"}},
+		"param set":     {path: httputil.NewPath("/foo/:foo").WithParam("foo", "bar"), uri: "/foo/baz"},
+		"query ignored": {path: httputil.NewPath("/foo?a=A"), uri: "/foo", match: true, params: map[string]string{}},
+		"too long":      {path: httputil.NewPath("/foo/:foo"), uri: "/foo/bar/baz"},
+		"empty param":   {path: httputil.NewPath("/foo/:foo/baz"), uri: "/foo//baz"},
+		"different":     {path: httputil.NewPath("/foo/:foo"), uri: "/bar/baz"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			params, ok := tc.path.Match(tc.uri)
+			if ok != tc.match || !maps.Equal(params, tc.params) {
+				t.Errorf("\n want: %v %v\n got:  %v %v", tc.match, tc.params, ok, params)
+			}
+		})
+	}
+}
 func ExamplePath() {
 	const pathFoo = "/foo/:foo"
 	uri := httputil.NewPath(pathFoo).
@@ -0,0 +1,98 @@
+package httputil
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	ApplicationProblemJSON = "application/problem+json"
+)
+
+// ProblemDetails is an RFC 9457 problem details object
+// DecodeResOrErrRes returns one as the error when the response is an
+// application/problem+json error and no errRes was given
+// members other than the standard ones are kept in Extensions
+type ProblemDetails struct {
+	Type       string         `json:"type,omitempty"`
+	Title      string         `json:"title,omitempty"`
+	Status     int            `json:"status,omitempty"`
+	Detail     string         `json:"detail,omitempty"`
+	Instance   string         `json:"instance,omitempty"`
+	Extensions map[string]any `json:"-"`
+}
+
+func (p *ProblemDetails) Error() string {
+	msg := "problem"
+	if p.Status != 0 {
+		msg += fmt.Sprintf(" %d", p.Status)
+	}
+	if p.Title != "" {
+		msg += ": " + p.Title
+	}
+	if p.Detail != "" {
+		msg += ": " + p.Detail
+	}
+	return msg
+}
+
+// UnmarshalJSON ignores standard members with the wrong type as RFC 9457 requires
+func (p *ProblemDetails) UnmarshalJSON(b []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(b, &members); err != nil {
+		return err
+	}
+	*p = ProblemDetails{}
+	for k, v := range members {
+		switch k {
+		case "type":
+			_ = json.Unmarshal(v, &p.Type)
+		case "title":
+			_ = json.Unmarshal(v, &p.Title)
+		case "status":
+			_ = json.Unmarshal(v, &p.Status)
+		case "detail":
+			_ = json.Unmarshal(v, &p.Detail)
+		case "instance":
+			_ = json.Unmarshal(v, &p.Instance)
+		default:
+			var ext any
+			if err := json.Unmarshal(v, &ext); err != nil {
+				return err
+			}
+			if p.Extensions == nil {
+				p.Extensions = make(map[string]any)
+			}
+			p.Extensions[k] = ext
+		}
+	}
+	return nil
+}
+func (p ProblemDetails) MarshalJSON() ([]byte, error) {
+	out := make(map[string]any, len(p.Extensions)+5)
+	for k, v := range p.Extensions {
+		out[k] = v
+	}
+	for k, v := range map[string]string{
+		"type":     p.Type,
+		"title":    p.Title,
+		"detail":   p.Detail,
+		"instance": p.Instance,
+	} {
+		if v != "" {
+			out[k] = v
+		}
+	}
+	if p.Status != 0 {
+		out["status"] = p.Status
+	}
+	return json.Marshal(out)
+}
+
+func isProblemJSON(h http.Header) bool {
+	mediaType, _, err := mime.ParseMediaType(h.Get(HeaderContentType))
+	return err == nil && strings.EqualFold(mediaType, ApplicationProblemJSON)
+}
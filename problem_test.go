@@ -0,0 +1,91 @@
+package httputil_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+const problemJSON = `{
+	"type": "https://example.com/probs/out-of-credit",
+	"title": "You do not have enough credit.",
+	"status": 403,
+	"detail": "Your current balance is 30, but that costs 50.",
+	"instance": "/account/12345/msgs/abc",
+	"balance": 30
+}`
+
+func TestProblemDetails_JSON(t *testing.T) {
+	t.Run("decode", func(t *testing.T) {
+		var p httputil.ProblemDetails
+		require.NoError(t, json.Unmarshal([]byte(problemJSON), &p))
+		assert.Equal(t, "https://example.com/probs/out-of-credit", p.Type)
+		assert.Equal(t, "You do not have enough credit.", p.Title)
+		assert.Equal(t, http.StatusForbidden, p.Status)
+		assert.Equal(t, "Your current balance is 30, but that costs 50.", p.Detail)
+		assert.Equal(t, "/account/12345/msgs/abc", p.Instance)
+		assert.Equal(t, map[string]any{"balance": 30.0}, p.Extensions)
+	})
+	t.Run("wrong type ignored", func(t *testing.T) {
+		var p httputil.ProblemDetails
+		require.NoError(t, json.Unmarshal([]byte(`{"title": "t", "status": "403"}`), &p))
+		assert.Equal(t, "t", p.Title)
+		assert.Equal(t, 0, p.Status)
+	})
+	t.Run("round trip", func(t *testing.T) {
+		var a, b httputil.ProblemDetails
+		require.NoError(t, json.Unmarshal([]byte(problemJSON), &a))
+		out, err := json.Marshal(a)
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(out, &b))
+		assert.Equal(t, a, b)
+	})
+}
+func TestClient_ProblemDetails(t *testing.T) {
+	client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(httputil.HeaderContentType, httputil.ApplicationProblemJSON)
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte(problemJSON))
+	})
+	newReq := func(t *testing.T) *http.Request {
+		req, err := client.Request(ctx, http.MethodGet, "/", nil, nil)
+		require.NoError(t, err)
+		return req
+	}
+	t.Run("returned as the error when no errRes", func(t *testing.T) {
+		var out ResModel
+		res, err := client.DoAndDecode(newReq(t), &out, nil)
+		require.NotNil(t, res)
+		var p *httputil.ProblemDetails
+		require.True(t, errors.As(err, &p))
+		assert.Equal(t, http.StatusForbidden, p.Status)
+		assert.Equal(t, float64(30), p.Extensions["balance"])
+		assert.Contains(t, err.Error(), p.Title)
+	})
+	t.Run("errRes given", func(t *testing.T) {
+		var (
+			out    ResModel
+			errRes map[string]any
+		)
+		_, err := client.DoAndDecode(newReq(t), &out, &errRes)
+		require.NoError(t, err)
+		assert.Equal(t, "/account/12345/msgs/abc", errRes["instance"])
+	})
+	t.Run("wrapped in HTTPError", func(t *testing.T) {
+		_, err := client.WithStatusErrors(true).DoAndDecode(newReq(t), nil, nil)
+		assert.ErrorIs(t, err, httputil.ErrForbidden)
+		var (
+			httpErr *httputil.HTTPError
+			p       *httputil.ProblemDetails
+		)
+		require.True(t, errors.As(err, &httpErr))
+		require.True(t, errors.As(err, &p))
+		assert.Same(t, p, httpErr.ErrRes)
+		assert.Equal(t, "You do not have enough credit.", p.Title)
+	})
+}
@@ -0,0 +1,139 @@
+package httputil
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type (
+	// QuotaWindow is the state of one RateLimitWindow as returned by RateLimiter.Remaining
+	QuotaWindow struct {
+		Limit     int
+		Per       time.Duration
+		Remaining int
+		Reset     time.Time // when the current window ends and Remaining goes back to Limit
+	}
+
+	// quota counts the calls in a fixed window, windows are aligned with time.Truncate
+	quota struct {
+		limit int
+		per   time.Duration
+		start time.Time
+		used  int
+	}
+)
+
+// RateLimitWindow adds a quota of limit calls per window on top of the refill rate
+// so NewRateLimiter(10, RateLimitWindow(500, time.Minute), RateLimitWindow(50000, 24*time.Hour))
+// is "10/s, 500/min, 50k/day", Wait only goes ahead when every window has a call left
+// windows are fixed and aligned with time.Truncate, so a day resets at midnight UTC
+func RateLimitWindow(limit int, per time.Duration) RateLimitOption {
+	return func(r *RateLimiter) { r.quotas = append(r.quotas, &quota{limit: limit, per: per}) }
+}
+
+// Remaining reports how many calls are left in each RateLimitWindow, in the order they were added
+func (r *RateLimiter) Remaining() []QuotaWindow {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		now     = time.Now()
+		windows = make([]QuotaWindow, len(r.quotas))
+	)
+	for i, q := range r.quotas {
+		q.roll(now)
+		windows[i] = QuotaWindow{
+			Limit:     q.limit,
+			Per:       q.per,
+			Remaining: max(q.limit-q.used, 0),
+			Reset:     q.start.Add(q.per),
+		}
+	}
+	return windows
+}
+
+// waitQuotas reserves a call from the limiter and every window at once, or from none of them
+// while any window is used up it sleeps until that window resets and tries again
+func (r *RateLimiter) waitQuotas(ctx context.Context) error {
+	for {
+		now := time.Now()
+		r.mu.Lock()
+		if wait := r.quotaWait(now); wait > 0 {
+			r.mu.Unlock()
+			if err := sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+		reservation := r.Limiter.ReserveN(now, 1)
+		if !reservation.OK() {
+			r.mu.Unlock()
+			return fmt.Errorf("%s: burst is %d", "rate limit reservation failed", r.Limiter.Burst())
+		}
+		starts := make([]time.Time, len(r.quotas))
+		for i, q := range r.quotas {
+			q.used++
+			starts[i] = q.start
+		}
+		r.mu.Unlock()
+
+		if err := sleep(ctx, reservation.DelayFrom(now)); err != nil {
+			reservation.Cancel()
+			r.releaseQuotas(starts)
+			return err
+		}
+		return nil
+	}
+}
+
+// quotaWait is how long until every window has a call left, the caller must hold mu
+func (r *RateLimiter) quotaWait(now time.Time) time.Duration {
+	var wait time.Duration
+	for _, q := range r.quotas {
+		q.roll(now)
+		if q.used >= q.limit {
+			wait = max(wait, q.start.Add(q.per).Sub(now))
+		}
+	}
+	return wait
+}
+
+// releaseQuotas gives back a reserved call to the windows which have not rolled over since
+func (r *RateLimiter) releaseQuotas(starts []time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, q := range r.quotas {
+		if q.start.Equal(starts[i]) && q.used > 0 {
+			q.used--
+		}
+	}
+}
+
+// holdsState reports if the limiter is paused or has used some of a quota window
+// which a new limiter would not know about
+func (r *RateLimiter) holdsState(now time.Time) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pausedUntil.After(now) {
+		return true
+	}
+	for _, q := range r.quotas {
+		if q.roll(now); q.used > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// roll starts a new window once the current one has ended
+func (q *quota) roll(now time.Time) {
+	if start := now.Truncate(q.per); !start.Equal(q.start) {
+		q.start, q.used = start, 0
+	}
+}
@@ -0,0 +1,73 @@
+package httputil_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestRateLimiter_windows(t *testing.T) {
+	waitFor := func(t *testing.T, limiter *httputil.RateLimiter, d time.Duration) error {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+		return limiter.Wait(ctx)
+	}
+	remaining := func(limiter *httputil.RateLimiter) []int {
+		var left []int
+		for _, w := range limiter.Remaining() {
+			left = append(left, w.Remaining)
+		}
+		return left
+	}
+
+	t.Run("all or none", func(t *testing.T) {
+		limiter := httputil.NewRateLimiter(1000,
+			httputil.RateLimitWindow(3, time.Hour),
+			httputil.RateLimitWindow(5, 24*time.Hour),
+		)
+		assert.Equal(t, []int{3, 5}, remaining(limiter))
+		for i := 0; i < 3; i++ {
+			require.NoError(t, waitFor(t, limiter, time.Second))
+		}
+		assert.Equal(t, []int{0, 2}, remaining(limiter))
+
+		// the hour is used up so the day is not touched either
+		assert.ErrorIs(t, waitFor(t, limiter, 10*time.Millisecond), context.DeadlineExceeded)
+		assert.Equal(t, []int{0, 2}, remaining(limiter))
+
+		windows := limiter.Remaining()
+		assert.Equal(t, 3, windows[0].Limit)
+		assert.Equal(t, time.Hour, windows[0].Per)
+		assert.Equal(t, time.Now().Truncate(time.Hour).Add(time.Hour), windows[0].Reset)
+		assert.Equal(t, time.Now().Truncate(24*time.Hour).Add(24*time.Hour), windows[1].Reset)
+	})
+	t.Run("released when canceled", func(t *testing.T) {
+		limiter := httputil.NewRateLimiter(1.0/3600, httputil.RateLimitWindow(10, time.Hour))
+		require.NoError(t, waitFor(t, limiter, time.Second))
+		assert.ErrorIs(t, waitFor(t, limiter, 10*time.Millisecond), context.DeadlineExceeded)
+		assert.Equal(t, []int{9}, remaining(limiter))
+	})
+	t.Run("next window", func(t *testing.T) {
+		var (
+			per     = 100 * time.Millisecond
+			limiter = httputil.NewRateLimiter(1000, httputil.RateLimitWindow(2, per))
+		)
+		time.Sleep(time.Until(time.Now().Truncate(per).Add(per))) // start at the beginning of a window
+		for i := 0; i < 2; i++ {
+			require.NoError(t, waitFor(t, limiter, time.Second))
+		}
+		reset := limiter.Remaining()[0].Reset
+		require.NoError(t, waitFor(t, limiter, time.Second))
+		assert.False(t, time.Now().Before(reset), "the third call waited for the next window")
+		assert.Equal(t, []int{1}, remaining(limiter))
+	})
+	t.Run("nil safe", func(t *testing.T) {
+		var limiter *httputil.RateLimiter
+		assert.Empty(t, limiter.Remaining())
+	})
+}
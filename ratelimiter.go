@@ -3,6 +3,8 @@ package httputil
 import (
 	"context"
 	"math"
+	"sync"
+	"time"
 
 	"golang.org/x/time/rate"
 )
@@ -11,6 +13,26 @@ type (
 	RateLimiter struct {
 		Limiter       *rate.Limiter
 		changePercent float64 // 0.1 = 10%
+
+		// adaptive mode, see RateLimitAdaptive
+		mu        sync.Mutex
+		successes int     // consecutive successes since the last change
+		window    int     // successes needed before an increase, 0 = not adaptive
+		increase  float64 // added to the limit after window successes
+		floor     float64 // 0 = no floor
+		ceiling   float64 // 0 = no ceiling
+		onChange  func(old, new float64)
+
+		// see RateLimitFromHeaders
+		fromHeaders bool
+		pausedUntil time.Time
+
+		quotas []*quota // see RateLimitWindow
+
+		// see RateLimitPersist
+		store        RateLimitStore
+		saveInterval time.Duration
+		savedAt      time.Time
 	}
 	RateLimitOption = func(*RateLimiter)
 )
@@ -33,6 +55,7 @@ func NewRateLimiter(limit float64, options ...RateLimitOption) *RateLimiter {
 	for _, option := range options {
 		option(rl)
 	}
+	_ = rl.Restore()
 	return rl
 }
 func RateLimitChangePercent(percent float64) RateLimitOption {
@@ -42,6 +65,28 @@ func RateLimitBurst(burst int) RateLimitOption {
 	return func(r *RateLimiter) { r.SetBurst(burst) }
 }
 
+// RateLimitAdaptive turns on additive increase, multiplicative decrease
+// after every `successes` consecutive calls without a 429 the limit grows by `increase`
+// while SlowDown still cuts it by changePercent, so the limit recovers after a 429 storm
+func RateLimitAdaptive(successes int, increase float64) RateLimitOption {
+	return func(r *RateLimiter) { r.window, r.increase = successes, increase }
+}
+
+// RateLimitFloor is the lowest limit SlowDown will go to
+func RateLimitFloor(limit float64) RateLimitOption {
+	return func(r *RateLimiter) { r.floor = limit }
+}
+
+// RateLimitCeiling is the highest limit SpeedUp and Success will go to
+func RateLimitCeiling(limit float64) RateLimitOption {
+	return func(r *RateLimiter) { r.ceiling = limit }
+}
+
+// RateLimitOnChange is called whenever SlowDown, SpeedUp or Success change the limit
+func RateLimitOnChange(fn func(old, new float64)) RateLimitOption {
+	return func(r *RateLimiter) { r.onChange = fn }
+}
+
 func (r *RateLimiter) Do(ctx context.Context, doFn func() error) error {
 	if err := r.Wait(ctx); err != nil {
 		return err
@@ -55,7 +100,18 @@ func (r *RateLimiter) Wait(ctx context.Context) error {
 	if r == nil || r.Limiter == nil {
 		return nil
 	}
-	return r.Limiter.Wait(ctx)
+	if err := sleep(ctx, r.pauseRemaining()); err != nil {
+		return err
+	}
+	wait := r.Limiter.Wait
+	if len(r.quotas) > 0 {
+		wait = r.waitQuotas
+	}
+	if err := wait(ctx); err != nil {
+		return err
+	}
+	r.maybeSave()
+	return nil
 }
 
 // SlowDown reduces the bucket refill rate by 10%
@@ -65,14 +121,56 @@ func (r *RateLimiter) SlowDown() {
 	if r == nil || r.Limiter == nil {
 		return
 	}
-	r.SetLimit(r.Limit() * (1 - r.changePercent))
+	r.change(func(limit float64) float64 { return limit * (1 - r.changePercent) })
 }
 func (r *RateLimiter) SpeedUp() {
 	if r == nil || r.Limiter == nil {
 		return
 	}
 	// to undo a 10% decrease we don't increase by 10% rather we divide by .9
-	r.SetLimit(r.Limit() / (1 - r.changePercent))
+	r.change(func(limit float64) float64 { return limit / (1 - r.changePercent) })
+}
+
+// Success reports a call which was not rate limited, Client.do calls it for you
+// in adaptive mode every window consecutive successes increase the limit, otherwise it does nothing
+func (r *RateLimiter) Success() {
+	if r == nil || r.Limiter == nil || r.window <= 0 {
+		return
+	}
+	r.mu.Lock()
+	r.successes++
+	grow := r.successes >= r.window
+	r.mu.Unlock()
+	if grow {
+		r.change(func(limit float64) float64 { return limit + r.increase })
+	}
+}
+
+// change sets the limit to fn(limit) kept between floor and ceiling
+// and restarts the count of consecutive successes
+func (r *RateLimiter) change(fn func(limit float64) float64) {
+	r.mu.Lock()
+	var (
+		old   = r.Limit()
+		limit = r.clamp(fn(old))
+	)
+	r.successes = 0
+	r.Limiter.SetLimit(rate.Limit(limit))
+	r.mu.Unlock()
+	if r.onChange != nil && limit != old {
+		r.onChange(old, limit)
+	}
+}
+
+// clamp keeps limit between floor and ceiling
+func (r *RateLimiter) clamp(limit float64) float64 {
+	if r.floor > 0 {
+		limit = max(limit, r.floor)
+	}
+	if r.ceiling > 0 {
+		limit = min(limit, r.ceiling)
+	}
+	return limit
 }
 
 // SetLimit sets the refill rate on the limiter
@@ -3,6 +3,7 @@ package httputil_test
 import (
 	"errors"
 	"math"
+	"net/http"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -95,6 +96,70 @@ func TestRateLimiter_nilSafe(t *testing.T) {
 		limiter.SpeedUp()
 	})
 }
+func TestRateLimiter_adaptive(t *testing.T) {
+	var changes [][2]float64
+	limiter := httputil.NewRateLimiter(10,
+		httputil.RateLimitChangePercent(0.5),
+		httputil.RateLimitAdaptive(3, 1),
+		httputil.RateLimitFloor(4),
+		httputil.RateLimitCeiling(12),
+		httputil.RateLimitOnChange(func(old, new float64) { changes = append(changes, [2]float64{old, new}) }),
+	)
+
+	limiter.SlowDown()
+	assertCloseEnough(t, 5, limiter.Limit())
+	limiter.SlowDown()
+	assertCloseEnough(t, 4, limiter.Limit()) // floor
+	limiter.SlowDown()
+	assertCloseEnough(t, 4, limiter.Limit())
+
+	limiter.Success()
+	limiter.Success()
+	assertCloseEnough(t, 4, limiter.Limit())
+	limiter.Success()
+	assertCloseEnough(t, 5, limiter.Limit())
+
+	// a 429 restarts the count of consecutive successes
+	limiter.Success()
+	limiter.Success()
+	limiter.SlowDown()
+	limiter.Success()
+	limiter.Success()
+	assertCloseEnough(t, 4, limiter.Limit())
+
+	for i := 0; i < 30; i++ {
+		limiter.Success()
+	}
+	assertCloseEnough(t, 12, limiter.Limit()) // ceiling
+	assert.Equal(t, [][2]float64{{10, 5}, {5, 4}, {4, 5}, {5, 4}, {4, 5}, {5, 6}, {6, 7}, {7, 8}, {8, 9}, {9, 10}, {10, 11}, {11, 12}}, changes)
+
+	t.Run("not adaptive", func(t *testing.T) {
+		limiter := httputil.NewRateLimiter(10)
+		for i := 0; i < 10; i++ {
+			limiter.Success()
+		}
+		assert.Equal(t, 10.0, limiter.Limit())
+	})
+	t.Run("client", func(t *testing.T) {
+		var ctr atomic.Int32
+		limiter := httputil.NewRateLimiter(100, httputil.RateLimitAdaptive(2, 10))
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if ctr.Add(1) == 1 {
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}).WithRateLimiter(limiter)
+		// the 429 is retried and that success counts towards the next increase
+		for _, want := range []float64{90, 100} {
+			req, err := client.Request(ctx, http.MethodGet, "/ref", nil, nil)
+			require.NoError(t, err)
+			_, err = client.Do(req)
+			require.NoError(t, err)
+			assertCloseEnough(t, want, limiter.Limit())
+		}
+	})
+}
 
 func assertCloseEnough(t *testing.T, a, b float64) {
 	t.Helper()
@@ -0,0 +1,175 @@
+package httputil
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderXRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderXRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderXRateLimitReset     = "X-RateLimit-Reset"
+	HeaderRateLimit           = "RateLimit"
+	HeaderRateLimitPolicy     = "RateLimit-Policy"
+)
+
+// rateLimitHeaders is what a response advertised, negative values were not sent
+type rateLimitHeaders struct {
+	quota     float64       // calls allowed per window
+	window    time.Duration // from RateLimit-Policy w=
+	remaining float64       // calls left in the current window
+	reset     time.Duration // until the current window resets
+}
+
+// RateLimitFromHeaders makes the limiter learn from the rate limit headers of each response
+// see Observe for the headers which are understood
+func RateLimitFromHeaders() RateLimitOption {
+	return func(r *RateLimiter) { r.fromHeaders = true }
+}
+
+// Observe adjusts the limiter to the rate limit headers of res, Client.do calls it for you
+// it does nothing unless the limiter was built with RateLimitFromHeaders
+//
+// a RateLimit-Policy quota and window sets the limit to quota/window
+// otherwise the remaining calls are spread over the time until the reset
+// when no calls remain Wait pauses until the reset
+//
+// understood are X-RateLimit-Limit/Remaining/Reset, RateLimit-Limit/Remaining/Reset,
+// and RateLimit with RateLimit-Policy both as `limit=100, remaining=5, reset=30`
+// and as `"default";r=5;t=30` with `"default";q=100;w=60`
+func (r *RateLimiter) Observe(res *http.Response) {
+	if r == nil || r.Limiter == nil || !r.fromHeaders || res == nil {
+		return
+	}
+	rl, ok := parseRateLimitHeaders(res.Header, time.Now())
+	if !ok {
+		return
+	}
+	switch {
+	case rl.quota > 0 && rl.window > 0:
+		r.change(func(float64) float64 { return rl.quota / rl.window.Seconds() })
+	case rl.remaining > 0 && rl.reset > 0:
+		r.change(func(float64) float64 { return rl.remaining / rl.reset.Seconds() })
+	}
+	if rl.remaining == 0 && rl.reset > 0 {
+		r.pause(time.Now().Add(rl.reset))
+	}
+}
+
+// pause makes Wait block until t, an earlier pause is never shortened
+func (r *RateLimiter) pause(t time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if t.After(r.pausedUntil) {
+		r.pausedUntil = t
+	}
+}
+func (r *RateLimiter) pauseRemaining() time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return time.Until(r.pausedUntil)
+}
+
+func parseRateLimitHeaders(h http.Header, now time.Time) (rateLimitHeaders, bool) {
+	rl := rateLimitHeaders{quota: -1, window: -1, remaining: -1, reset: -1}
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if v, ok := headerNumber(h, prefix+"Limit"); ok {
+			rl.quota = v
+		}
+		if v, ok := headerNumber(h, prefix+"Remaining"); ok {
+			rl.remaining = v
+		}
+		if v, ok := headerNumber(h, prefix+"Reset"); ok {
+			rl.reset = resetDuration(v, now)
+		}
+	}
+
+	// RateLimit-Policy may list several policies, the slowest one wins
+	// the older drafts put them in RateLimit-Limit as `100, 100;w=60`
+	policies := append(rateLimitItems(h.Get(HeaderRateLimitPolicy)), rateLimitItems(h.Get("RateLimit-Limit"))...)
+	for _, item := range policies {
+		quota, window := item.number("q", "limit"), item.number("w")
+		if quota < 0 || window <= 0 {
+			continue
+		}
+		if rl.window <= 0 || quota/window < rl.quota/rl.window.Seconds() {
+			rl.quota, rl.window = quota, time.Duration(window*float64(time.Second))
+		}
+	}
+
+	// RateLimit may list several policies, the one with the fewest calls remaining wins
+	var remaining, reset float64 = -1, -1
+	for _, item := range rateLimitItems(h.Get(HeaderRateLimit)) {
+		if v := item.number("r", "remaining"); v >= 0 && (remaining < 0 || v < remaining) {
+			remaining = v
+			if t := item.number("t", "reset"); t >= 0 {
+				reset = t
+			}
+		} else if t := item.number("t", "reset"); t >= 0 && reset < 0 {
+			reset = t // `limit=100, remaining=5, reset=30` is three items
+		}
+		if v := item.number("limit"); v >= 0 && rl.quota < 0 {
+			rl.quota = v
+		}
+	}
+	if remaining >= 0 {
+		rl.remaining = remaining
+	}
+	if reset >= 0 {
+		rl.reset = time.Duration(reset * float64(time.Second))
+	}
+	return rl, rl.quota >= 0 || rl.remaining >= 0 || rl.reset >= 0
+}
+
+// resetDuration treats large values as a unix time, as sent by GitHub, and others as delay seconds
+func resetDuration(v float64, now time.Time) time.Duration {
+	if v > 1e9 {
+		return max(time.Unix(int64(v), 0).Sub(now), 0)
+	}
+	return time.Duration(v * float64(time.Second))
+}
+
+// headerNumber parses the leading number of header k, so `100, 100;w=60` is 100
+func headerNumber(h http.Header, k string) (float64, bool) {
+	v := strings.TrimSpace(h.Get(k))
+	if i := strings.IndexAny(v, ",;"); i >= 0 {
+		v = strings.TrimSpace(v[:i])
+	}
+	n, err := strconv.ParseFloat(v, 64)
+	return n, err == nil && n >= 0
+}
+
+// rateLimitItem holds the params of one list item, a bare number is kept as "q"
+type rateLimitItem map[string]string
+
+func rateLimitItems(v string) []rateLimitItem {
+	var items []rateLimitItem
+	for _, member := range strings.Split(v, ",") {
+		item := rateLimitItem{}
+		for i, param := range strings.Split(member, ";") {
+			k, val, ok := strings.Cut(strings.TrimSpace(param), "=")
+			switch {
+			case ok:
+				item[strings.ToLower(strings.TrimSpace(k))] = strings.Trim(strings.TrimSpace(val), `"`)
+			case i == 0 && k != "" && k[0] != '"':
+				item["q"] = k
+			}
+		}
+		if len(item) > 0 {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// number returns the first of keys which holds a number, or -1
+func (item rateLimitItem) number(keys ...string) float64 {
+	for _, k := range keys {
+		if n, err := strconv.ParseFloat(item[k], 64); err == nil && n >= 0 {
+			return n
+		}
+	}
+	return -1
+}
@@ -0,0 +1,100 @@
+package httputil_test
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestRateLimiter_Observe(t *testing.T) {
+	var tests = map[string]struct {
+		header http.Header
+		limit  float64
+	}{
+		"x-ratelimit": {
+			header: http.Header{"X-Ratelimit-Limit": {"100"}, "X-Ratelimit-Remaining": {"10"}, "X-Ratelimit-Reset": {"5"}},
+			limit:  2,
+		},
+		"policy": {
+			header: http.Header{"Ratelimit-Policy": {`"burst";q=100;w=60, "daily";q=1000;w=86400`}, "Ratelimit": {`"daily";r=10;t=5`}},
+			limit:  1000.0 / 86400,
+		},
+		"policy in RateLimit-Limit": {
+			header: http.Header{"Ratelimit-Limit": {"100, 100;w=60"}, "Ratelimit-Remaining": {"50"}, "Ratelimit-Reset": {"25"}},
+			limit:  100.0 / 60,
+		},
+		"dictionary": {
+			header: http.Header{"Ratelimit": {"limit=100, remaining=50, reset=25"}},
+			limit:  2,
+		},
+		"structured": {
+			header: http.Header{"Ratelimit": {`"default";r=10;t=5, "daily";r=500;t=1000`}},
+			limit:  2,
+		},
+		"none": {
+			header: http.Header{"Content-Type": {"application/json"}},
+			limit:  1000,
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			limiter := httputil.NewRateLimiter(1000, httputil.RateLimitFromHeaders())
+			limiter.Observe(&http.Response{Header: tc.header})
+			assertCloseEnough(t, tc.limit, limiter.Limit())
+		})
+	}
+	t.Run("unix reset", func(t *testing.T) {
+		limiter := httputil.NewRateLimiter(1000, httputil.RateLimitFromHeaders())
+		reset := time.Now().Add(50 * time.Second).Unix()
+		limiter.Observe(&http.Response{Header: http.Header{
+			"X-Ratelimit-Remaining": {"100"},
+			"X-Ratelimit-Reset":     {strconv.FormatInt(reset, 10)},
+		}})
+		assert.InDelta(t, 2, limiter.Limit(), 0.1)
+	})
+	t.Run("off by default", func(t *testing.T) {
+		limiter := httputil.NewRateLimiter(1000)
+		limiter.Observe(&http.Response{Header: http.Header{"Ratelimit": {`"default";r=0;t=5`}}})
+		assert.Equal(t, 1000.0, limiter.Limit())
+		require.NoError(t, limiter.Wait(ctx))
+	})
+	t.Run("pause until reset", func(t *testing.T) {
+		limiter := httputil.NewRateLimiter(1000, httputil.RateLimitFromHeaders())
+		limiter.Observe(&http.Response{Header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"0.2"}}})
+		start := time.Now()
+		require.NoError(t, limiter.Wait(ctx))
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+
+		limiter.Observe(&http.Response{Header: http.Header{"X-Ratelimit-Remaining": {"0"}, "X-Ratelimit-Reset": {"5"}}})
+		ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		assert.ErrorIs(t, limiter.Wait(ctx), context.DeadlineExceeded)
+	})
+	t.Run("client", func(t *testing.T) {
+		var ctr atomic.Int32
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if ctr.Add(1) == 1 {
+				w.Header().Set(httputil.HeaderXRateLimitRemaining, "0")
+				w.Header().Set(httputil.HeaderXRateLimitReset, "0.2")
+			}
+			w.WriteHeader(http.StatusOK)
+		}).WithRateLimiter(httputil.NewRateLimiter(1000, httputil.RateLimitFromHeaders()))
+
+		start := time.Now()
+		for i := 0; i < 2; i++ {
+			req, err := client.Request(ctx, http.MethodGet, "/ref", nil, nil)
+			require.NoError(t, err)
+			res, err := client.Do(req)
+			require.NoError(t, err)
+			assert.Equal(t, http.StatusOK, res.StatusCode)
+		}
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond, "second call waited for the reset")
+	})
+}
@@ -0,0 +1,186 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+type (
+	// RateLimitState is a snapshot of a RateLimiter which a RateLimitStore keeps between runs
+	RateLimitState struct {
+		SavedAt     time.Time    `json:"savedAt"`
+		Limit       float64      `json:"limit"`
+		Tokens      float64      `json:"tokens"` // left in the bucket at SavedAt
+		PausedUntil time.Time    `json:"pausedUntil,omitempty"`
+		Quotas      []QuotaState `json:"quotas,omitempty"`
+	}
+	// QuotaState is the current window of one RateLimitWindow
+	QuotaState struct {
+		Per   time.Duration `json:"per"`
+		Start time.Time     `json:"start"`
+		Used  int           `json:"used"`
+	}
+	// RateLimitStore keeps the state of a RateLimiter across process restarts
+	// Load returns false when nothing was saved yet
+	RateLimitStore interface {
+		Load() (RateLimitState, bool, error)
+		Save(state RateLimitState) error
+	}
+
+	// FileRateLimitStore is a RateLimitStore keeping the state as json in the file at Path
+	FileRateLimitStore struct {
+		Path string
+	}
+)
+
+// RateLimitPersist restores the limiter from store when it is built, so a restart resumes
+// with the tokens, limit and quota counters it had rather than a full burst
+// Wait saves the state to store at most once every interval, and Save saves it right away
+// a state which can't be loaded is ignored, call Restore to see the error
+func RateLimitPersist(store RateLimitStore, interval time.Duration) RateLimitOption {
+	return func(r *RateLimiter) { r.store, r.saveInterval = store, interval }
+}
+
+// State is a snapshot of the limiter
+func (r *RateLimiter) State() RateLimitState {
+	if r == nil || r.Limiter == nil {
+		return RateLimitState{}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	state := RateLimitState{
+		SavedAt:     now,
+		Limit:       float64(r.Limiter.Limit()),
+		Tokens:      r.Limiter.TokensAt(now),
+		PausedUntil: r.pausedUntil,
+	}
+	for _, q := range r.quotas {
+		q.roll(now)
+		state.Quotas = append(state.Quotas, QuotaState{Per: q.per, Start: q.start, Used: q.used})
+	}
+	return state
+}
+
+// Save writes the state to the RateLimitPersist store, call it before the process exits
+func (r *RateLimiter) Save() error {
+	if r == nil || r.store == nil {
+		return nil
+	}
+	if err := r.store.Save(r.State()); err != nil {
+		return fmt.Errorf("%s: %w", "save rate limit state failed", err)
+	}
+	return nil
+}
+
+// Restore loads the state from the RateLimitPersist store, NewRateLimiter calls it for you
+func (r *RateLimiter) Restore() error {
+	if r == nil || r.Limiter == nil || r.store == nil {
+		return nil
+	}
+	state, ok, err := r.store.Load()
+	if err != nil {
+		return fmt.Errorf("%s: %w", "load rate limit state failed", err)
+	}
+	if ok {
+		r.restore(state)
+	}
+	return nil
+}
+
+// restore replaces the limiter with one drained to state.Tokens at state.SavedAt
+// so it refills from then on as if the process had never stopped
+func (r *RateLimiter) restore(state RateLimitState) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		burst = r.Limiter.Burst()
+		limit = r.clamp(state.Limit)
+	)
+	if limit <= 0 {
+		limit = float64(r.Limiter.Limit())
+	}
+	limiter := rate.NewLimiter(rate.Limit(limit), burst)
+	for drain := int(math.Ceil(float64(burst) - state.Tokens)); drain > 0 && burst > 0; drain -= burst {
+		limiter.ReserveN(state.SavedAt, min(drain, burst))
+	}
+	r.Limiter = limiter
+	r.pausedUntil = state.PausedUntil
+	for _, q := range r.quotas {
+		for _, saved := range state.Quotas {
+			if saved.Per == q.per {
+				q.start, q.used = saved.Start, saved.Used
+				break
+			}
+		}
+	}
+}
+
+// maybeSave saves the state when the interval has passed since the last save
+func (r *RateLimiter) maybeSave() {
+	if r.store == nil {
+		return
+	}
+	r.mu.Lock()
+	due := time.Since(r.savedAt) >= r.saveInterval
+	if due {
+		r.savedAt = time.Now()
+	}
+	r.mu.Unlock()
+	if due {
+		_ = r.Save()
+	}
+}
+
+func NewFileRateLimitStore(path string) FileRateLimitStore {
+	return FileRateLimitStore{Path: path}
+}
+func (f FileRateLimitStore) Load() (RateLimitState, bool, error) {
+	var state RateLimitState
+	b, err := os.ReadFile(f.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, false, nil
+	}
+	if err != nil {
+		return state, false, err
+	}
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, false, err
+	}
+	return state, true, nil
+}
+
+// Save writes to a temp file which is renamed over Path, so a crash never leaves half a file
+func (f FileRateLimitStore) Save(state RateLimitState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(f.Path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, filepath.Base(f.Path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(b)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), f.Path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
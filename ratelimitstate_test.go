@@ -0,0 +1,78 @@
+package httputil_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestRateLimiter_persist(t *testing.T) {
+	t.Run("resume after restart", func(t *testing.T) {
+		var (
+			store   = httputil.NewFileRateLimitStore(filepath.Join(t.TempDir(), "limiter.json"))
+			options = []httputil.RateLimitOption{
+				httputil.RateLimitBurst(5),
+				httputil.RateLimitWindow(100, 24*time.Hour),
+				httputil.RateLimitPersist(store, time.Hour),
+			}
+			limiter = httputil.NewRateLimiter(10, options...)
+		)
+		for i := 0; i < 5; i++ {
+			require.NoError(t, limiter.Wait(ctx))
+		}
+		limiter.SlowDown()
+		require.NoError(t, limiter.Save())
+
+		restarted := httputil.NewRateLimiter(10, options...)
+		assertCloseEnough(t, 9, restarted.Limit())
+		assert.Less(t, restarted.State().Tokens, 1.0, "the burst was used before the restart")
+		assert.Equal(t, 95, restarted.Remaining()[0].Remaining)
+
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			require.NoError(t, restarted.Wait(ctx))
+		}
+		assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "no burst after the restart")
+	})
+	t.Run("refilled while stopped", func(t *testing.T) {
+		store := &memRateLimitStore{state: httputil.RateLimitState{
+			SavedAt: time.Now().Add(-time.Second),
+			Limit:   2,
+			Tokens:  0,
+		}, ok: true}
+		limiter := httputil.NewRateLimiter(10, httputil.RateLimitBurst(5), httputil.RateLimitPersist(store, 0))
+		assert.InDelta(t, 2, limiter.State().Tokens, 0.1)
+
+		require.NoError(t, limiter.Wait(ctx))
+		assert.InDelta(t, 1, store.state.Tokens, 0.1, "saved on every Wait with an interval of 0")
+	})
+	t.Run("nothing saved", func(t *testing.T) {
+		store := httputil.NewFileRateLimitStore(filepath.Join(t.TempDir(), "missing.json"))
+		limiter := httputil.NewRateLimiter(10, httputil.RateLimitBurst(5), httputil.RateLimitPersist(store, time.Hour))
+		require.NoError(t, limiter.Restore())
+		assert.InDelta(t, httputil.NewRateLimiter(10, httputil.RateLimitBurst(5)).State().Tokens, limiter.State().Tokens, 0.1)
+	})
+	t.Run("corrupt state", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "limiter.json")
+		require.NoError(t, os.WriteFile(path, []byte("{"), 0o600))
+		limiter := httputil.NewRateLimiter(10, httputil.RateLimitBurst(5), httputil.RateLimitPersist(httputil.NewFileRateLimitStore(path), time.Hour))
+		assert.Error(t, limiter.Restore())
+		assert.InDelta(t, httputil.NewRateLimiter(10, httputil.RateLimitBurst(5)).State().Tokens, limiter.State().Tokens, 0.1, "starts fresh")
+	})
+}
+
+type memRateLimitStore struct {
+	state httputil.RateLimitState
+	ok    bool
+}
+
+func (m *memRateLimitStore) Load() (httputil.RateLimitState, bool, error) { return m.state, m.ok, nil }
+func (m *memRateLimitStore) Save(state httputil.RateLimitState) error {
+	m.state, m.ok = state, true
+	return nil
+}
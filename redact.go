@@ -0,0 +1,185 @@
+package httputil
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+const (
+	Redacted = "[REDACTED]"
+)
+
+var (
+	// DefaultRedactHeaders are always redacted, Redaction.Headers adds to them
+	DefaultRedactHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+	// DefaultRedactQuery are always redacted, Redaction.Query adds to them
+	DefaultRedactQuery = []string{"access_token", "api_key", "apikey", "client_secret", "password", "token"}
+	// DefaultRedactBodyPaths are always redacted, Redaction.BodyPaths adds to them
+	DefaultRedactBodyPaths = []string{"password", "client_secret", "access_token", "refresh_token"}
+)
+
+// Redaction lists what Client masks with Redacted before a request or response is logged
+// the defaults above are always masked, so the zero value is already secure
+type Redaction struct {
+	Headers   []string // header names, case-insensitive
+	Query     []string // query parameter names, case-insensitive
+	BodyPaths []string // dot separated paths into JSON bodies such as "user.password", * matches any key
+}
+
+func (r Redaction) WithHeaders(names ...string) Redaction {
+	r.Headers = append(slices.Clip(r.Headers), names...)
+	return r
+}
+func (r Redaction) WithQuery(names ...string) Redaction {
+	r.Query = append(slices.Clip(r.Query), names...)
+	return r
+}
+func (r Redaction) WithBodyPaths(paths ...string) Redaction {
+	r.BodyPaths = append(slices.Clip(r.BodyPaths), paths...)
+	return r
+}
+
+// header returns a copy of h with the values of redacted headers masked
+func (r Redaction) header(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	out := h.Clone()
+	for k := range out {
+		if redacts(k, DefaultRedactHeaders, r.Headers) {
+			out[k] = []string{Redacted}
+		}
+	}
+	return out
+}
+
+// query masks redacted parameters in a raw query, keeping the order and encoding of the rest
+func (r Redaction) query(rawQuery string) string {
+	return redactParams(rawQuery, DefaultRedactQuery, r.Query)
+}
+
+// url masks redacted parameters in the query of a raw url
+func (r Redaction) url(rawURL string) string {
+	base, rawQuery, ok := strings.Cut(rawURL, "?")
+	if !ok {
+		return rawURL
+	}
+	return base + "?" + r.query(rawQuery)
+}
+
+// error returns a copy of err with the query of its *url.Error masked, as transport errors print the full url
+// an error which wraps the *url.Error becomes a plain error with the same text, masked, so use it for logs only
+func (r Redaction) error(err error) error {
+	var urlErr *url.Error
+	if !errors.As(err, &urlErr) {
+		return err
+	}
+	masked := *urlErr
+	masked.URL = r.url(urlErr.URL)
+	if err == error(urlErr) {
+		return &masked
+	}
+	return errors.New(strings.ReplaceAll(err.Error(), urlErr.URL, masked.URL))
+}
+
+// form masks a form encoded body, its params are redacted by both the query names and the body paths
+func (r Redaction) form(body string) string {
+	return redactParams(body, DefaultRedactQuery, r.Query, DefaultRedactBodyPaths, r.BodyPaths)
+}
+func redactParams(rawQuery string, names ...[]string) string {
+	if rawQuery == "" {
+		return rawQuery
+	}
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		k, _, hasValue := strings.Cut(param, "=")
+		if name, err := url.QueryUnescape(k); err == nil && hasValue && redacts(name, names...) {
+			params[i] = k + "=" + Redacted
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+// redacts reports if name is in any of the lists, ignoring case
+func redacts(name string, lists ...[]string) bool {
+	for _, names := range lists {
+		if slices.ContainsFunc(names, func(k string) bool { return strings.EqualFold(k, name) }) {
+			return true
+		}
+	}
+	return false
+}
+
+// bodyBytes masks a form or JSON body with content type from h, other bodies are returned as they are
+func (r Redaction) bodyBytes(h http.Header, b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	if mediaType, _, _ := mime.ParseMediaType(h.Get(HeaderContentType)); mediaType == ApplicationForm {
+		return []byte(r.form(string(b)))
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		return b
+	}
+	masked, err := json.Marshal(r.body(v))
+	if err != nil {
+		return b
+	}
+	return masked
+}
+
+// body masks the redacted paths in a decoded JSON body, in place
+// arrays are walked through so "items.secret" masks the secret of every item
+func (r Redaction) body(v any) any {
+	for _, paths := range [][]string{DefaultRedactBodyPaths, r.BodyPaths} {
+		for _, path := range paths {
+			redactPath(v, strings.Split(path, "."))
+		}
+	}
+	return v
+}
+
+// jsonHead masks the values of the redacted keys in JSON which was cut and so can not be decoded
+// only the last key of each path is matched, wherever it is, so it can mask more than body does
+func (r Redaction) jsonHead(s string) string {
+	var keys []string
+	for _, paths := range [][]string{DefaultRedactBodyPaths, r.BodyPaths} {
+		for _, path := range paths {
+			key := path[strings.LastIndex(path, ".")+1:]
+			if key == "*" {
+				key = `(?:[^"\\]|\\.)*`
+			} else {
+				key = regexp.QuoteMeta(key)
+			}
+			keys = append(keys, key)
+		}
+	}
+	re := regexp.MustCompile(`("(?:` + strings.Join(keys, "|") + `)"\s*:\s*)(?:"(?:[^"\\]|\\.)*"?|[^,}\]\s]*)`)
+	return re.ReplaceAllString(s, `${1}"`+Redacted+`"`)
+}
+func redactPath(v any, path []string) {
+	switch v := v.(type) {
+	case []any:
+		for _, item := range v {
+			redactPath(item, path)
+		}
+	case map[string]any:
+		for k, val := range v {
+			if path[0] != "*" && path[0] != k {
+				continue
+			}
+			if len(path) == 1 {
+				v[k] = Redacted
+				continue
+			}
+			redactPath(val, path[1:])
+		}
+	}
+}
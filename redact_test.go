@@ -0,0 +1,97 @@
+package httputil_test
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_WithRedaction(t *testing.T) {
+	var (
+		buf    bytes.Buffer
+		logger = slog.New(slog.NewJSONHandler(&buf, nil))
+		secret = "s3cr3t"
+	)
+	client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "session", Value: secret})
+		writeJSON(w, map[string]any{
+			"access_token": secret,
+			"user":         map[string]any{"name": "Robert", "pin": secret},
+			"items":        []any{map[string]any{"key": secret}},
+		})
+	}).
+		WithLogger(logger).
+		WithSetHeader("Authorization", "Bearer "+secret).
+		WithSetHeader("X-API-Key", secret)
+	client = client.WithRedaction(client.Redaction.
+		WithHeaders("x-api-key").
+		WithQuery("sig").
+		WithBodyPaths("user.pin", "items.key"))
+
+	req, err := client.Request(ctx, http.MethodGet, "/ref?page=2&sig="+secret+"&token="+secret, nil, nil)
+	require.NoError(t, err)
+	res, err := client.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	logged := buf.String()
+	assert.NotContains(t, logged, secret)
+	assert.Contains(t, logged, httputil.Redacted)
+	assert.Contains(t, logged, "page=2")
+	assert.Contains(t, logged, "Robert")
+}
+func TestClient_WithRedaction_defaults(t *testing.T) {
+	var (
+		buf    bytes.Buffer
+		logger = slog.New(slog.NewJSONHandler(&buf, nil))
+		secret = "s3cr3t"
+	)
+	client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"refresh_token": secret, "id": "1"})
+	}).
+		WithLogger(logger).
+		WithSetHeader("Cookie", "session="+secret)
+
+	req, err := client.Request(ctx, http.MethodGet, "/ref?access_token="+secret, nil, nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.NoError(t, err)
+
+	assert.NotContains(t, buf.String(), secret)
+	assert.Contains(t, buf.String(), httputil.Redacted)
+}
+func TestClient_WithRedaction_transportError(t *testing.T) {
+	var (
+		buf    bytes.Buffer
+		logger = slog.New(slog.NewJSONHandler(&buf, nil))
+		secret = "s3cr3t"
+	)
+	client := httputil.NewClient().
+		WithHost("http://127.0.0.1:1"). // nothing listens here
+		WithLogger(logger).
+		WithRetryPolicy(retryOnce{})
+
+	req, err := client.Request(ctx, http.MethodGet, "/x?page=2&api_key="+secret, nil, nil)
+	require.NoError(t, err)
+	_, err = client.Do(req)
+	require.Error(t, err)
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 2)
+	assert.Contains(t, lines[0]["error"], "api_key="+httputil.Redacted)
+	assert.Contains(t, lines[1]["retryReason"], "api_key="+httputil.Redacted)
+	assert.NotContains(t, buf.String(), secret)
+}
+
+// retryOnce retries anything once, even a refused connection
+type retryOnce struct{}
+
+func (retryOnce) Retry(attempt int, _ *http.Request, _ *http.Response, _ error) (time.Duration, bool) {
+	return 0, attempt == 1
+}
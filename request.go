@@ -3,6 +3,7 @@ package httputil
 import (
 	"errors"
 	"net/http"
+	"net/url"
 	"strings"
 )
 
@@ -12,6 +13,16 @@ type (
 		Header() http.Header // embed ReqHeaders into your model for this
 		Validate() error
 	}
+	// RequestBody is optional, implement it on a Request model when the body
+	// to send is not the model itself, such as a Multipart, url.Values or io.Reader
+	RequestBody interface {
+		Body() any
+	}
+	// IdempotentRequest is optional, implement it on a Request model to supply its own Idempotency-Key
+	// such as one derived from an order id, so that it is also the same across separate calls
+	IdempotentRequest interface {
+		IdempotencyKey() string
+	}
 	ReqHeaders struct {
 		ReqID string // optional req header
 		h     http.Header
@@ -62,7 +73,28 @@ func reqWithHeaders(req *http.Request, headerMaps ...http.Header) *http.Request
 	}
 	return req
 }
+
+// withHeader returns a copy of h with key set so the caller's header is not modified
+func withHeader(h http.Header, key, value string) http.Header {
+	h = h.Clone()
+	if h == nil {
+		h = make(http.Header)
+	}
+	h.Set(key, value)
+	return h
+}
+
+// requestBody is what to send as the body for r, r itself unless it implements RequestBody
+func requestBody(r Request) any {
+	if rb, ok := r.(RequestBody); ok {
+		return rb.Body()
+	}
+	return r
+}
 func uriWithBase(uri, baseURL, pathPrefix string) string {
+	if u, err := url.Parse(uri); err == nil && u.IsAbs() && u.Host != "" {
+		return uri // already absolute such as a Link header from the server
+	}
 	baseURL = slashJoin(baseURL, pathPrefix)
 	if baseURL != "" && !strings.HasPrefix(uri, baseURL) {
 		return slashJoin(baseURL, uri)
@@ -3,24 +3,38 @@ package httputil
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"io"
 	"net/http"
 )
 
 // DecodeResponse attempts to decode the response body into out
+// using the Codec registered for the response Content-Type, JSONCodec when there is none
 // it will however replace the response body so that it can be read again
 // it also returns the body bytes so that you can debug if it did not work as expected
 func DecodeResponse(r *http.Response, out any) ([]byte, error) {
 	var (
-		buf bytes.Buffer
-		tr  = io.TeeReader(r.Body, &buf)
+		buf   bytes.Buffer
+		tr    = io.TeeReader(r.Body, &buf)
+		codec = responseCodec(r.Header)
+		err   error
 	)
 
-	if out == nil {
-		out = &json.RawMessage{}
+	switch _, isJSON := codec.(JSONCodec); {
+	case out != nil:
+		err = codec.Decode(tr, out)
+		if errors.Is(err, ErrCodecUnsupported) && !isJSON {
+			// servers often send json with a generic content type such as text/plain
+			_, _ = io.Copy(io.Discard, tr)
+			err = JSONCodec{}.Decode(bytes.NewReader(buf.Bytes()), out)
+		}
+	case isJSON:
+		err = codec.Decode(tr, &json.RawMessage{})
+	default:
+		_, err = io.Copy(io.Discard, tr)
 	}
 
-	if err := json.NewDecoder(tr).Decode(out); err != nil {
+	if err != nil {
 		if buf.Len() == 0 {
 			return nil, nil
 		}
@@ -32,9 +46,32 @@ func DecodeResponse(r *http.Response, out any) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
+// DecodeResOrErrRes decodes into badOut when the status is >= 400 else into goodOut
+// when badOut is nil and the response is application/problem+json
+// the decoded *ProblemDetails is returned as the error
 func DecodeResOrErrRes(r *http.Response, goodOut, badOut any) ([]byte, error) {
 	if r.StatusCode >= 400 {
+		if badOut == nil && isProblemJSON(r.Header) {
+			return decodeProblem(r)
+		}
 		return DecodeResponse(r, badOut)
 	}
 	return DecodeResponse(r, goodOut)
 }
+func decodeProblem(r *http.Response) ([]byte, error) {
+	var problem ProblemDetails
+	bodyBytes, err := DecodeResponse(r, &problem)
+	if err != nil {
+		return bodyBytes, err
+	}
+	if problem.Status == 0 {
+		problem.Status = r.StatusCode
+	}
+	return bodyBytes, &problem
+}
+func responseCodec(h http.Header) Codec {
+	if codec, ok := CodecFor(h.Get(HeaderContentType)); ok {
+		return codec
+	}
+	return JSONCodec{}
+}
@@ -0,0 +1,201 @@
+package httputil
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+type (
+	// RetryPolicy is asked by Client.Do after every attempt if the request should be sent again
+	// attempt starts at 1, res and err are the result of that attempt
+	// return the time to wait before the next attempt and true to retry
+	RetryPolicy interface {
+		Retry(attempt int, req *http.Request, res *http.Response, err error) (time.Duration, bool)
+	}
+	// BackoffPolicy is the RetryPolicy used by NewClient
+	// it retries 429 for any method, and 502, 503, 504 and connection resets only for idempotent
+	// methods or requests with an Idempotency-Key, unless AllMethods is true
+	// the wait is exponential backoff with full jitter unless the server sends Retry-After
+	BackoffPolicy struct {
+		MaxRetries    int
+		Statuses      []int         // status codes to retry, 429 is retried for any method
+		BaseDelay     time.Duration // max wait before the first retry, doubles for each retry after
+		MaxDelay      time.Duration // cap on the backoff, does not apply to Retry-After
+		MaxRetryAfter time.Duration // give up rather than wait when Retry-After is longer than this
+		AllMethods    bool          // also retry non-idempotent methods on 5xx and transport errors
+	}
+	RetryOption = func(*BackoffPolicy)
+)
+
+const (
+	DefaultRetries       = 2
+	DefaultRetryBase     = 100 * time.Millisecond
+	DefaultRetryMax      = 5 * time.Second
+	DefaultMaxRetryAfter = time.Minute
+	HeaderRetryAfter     = "Retry-After"
+)
+
+var (
+	DefaultRetryStatuses = []int{
+		http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout,
+	}
+)
+
+// NewRetryPolicy constructs a BackoffPolicy which retries DefaultRetryStatuses
+// and connection resets with exponential backoff and full jitter
+func NewRetryPolicy(maxRetries int, options ...RetryOption) *BackoffPolicy {
+	p := &BackoffPolicy{
+		MaxRetries:    maxRetries,
+		Statuses:      DefaultRetryStatuses,
+		BaseDelay:     DefaultRetryBase,
+		MaxDelay:      DefaultRetryMax,
+		MaxRetryAfter: DefaultMaxRetryAfter,
+	}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+func RetryStatuses(codes ...int) RetryOption {
+	return func(p *BackoffPolicy) { p.Statuses = codes }
+}
+func RetryDelay(base, max time.Duration) RetryOption {
+	return func(p *BackoffPolicy) { p.BaseDelay, p.MaxDelay = base, max }
+}
+func RetryMaxRetryAfter(d time.Duration) RetryOption {
+	return func(p *BackoffPolicy) { p.MaxRetryAfter = d }
+}
+func RetryAllMethods() RetryOption {
+	return func(p *BackoffPolicy) { p.AllMethods = true }
+}
+
+func (p *BackoffPolicy) Retry(attempt int, req *http.Request, res *http.Response, err error) (time.Duration, bool) {
+	if p == nil || attempt > p.MaxRetries || !p.retryable(req, res, err) {
+		return 0, false
+	}
+	if res != nil {
+		if wait, ok := retryAfter(res.Header, time.Now()); ok {
+			if p.MaxRetryAfter > 0 && wait > p.MaxRetryAfter {
+				return 0, false
+			}
+			return wait, true
+		}
+	}
+	return p.backoff(attempt), true
+}
+func (p *BackoffPolicy) retryable(req *http.Request, res *http.Response, err error) bool {
+	if err != nil {
+		return isConnReset(err) && p.methodRetryable(req)
+	}
+	if res == nil || !slices.Contains(p.Statuses, res.StatusCode) {
+		return false
+	}
+	return res.StatusCode == http.StatusTooManyRequests || p.methodRetryable(req)
+}
+func (p *BackoffPolicy) methodRetryable(req *http.Request) bool {
+	return p.AllMethods || isIdempotent(req) || (req != nil && req.Header.Get(HeaderIdempotency) != "")
+}
+
+// backoff returns a random duration between 0 and BaseDelay*2^(attempt-1) capped at MaxDelay
+func (p *BackoffPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 1; i < attempt && ceiling > 0; i++ {
+		ceiling *= 2
+		if p.MaxDelay > 0 && ceiling >= p.MaxDelay {
+			break
+		}
+	}
+	if p.MaxDelay > 0 && ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(ceiling) + 1))
+}
+
+// retryAfter parses the Retry-After header which is either delay-seconds or an HTTP-date
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := strings.TrimSpace(h.Get(HeaderRetryAfter))
+	if v == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		return time.Duration(max(secs, 0)) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+func isIdempotent(req *http.Request) bool {
+	if req == nil {
+		return false
+	}
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace,
+		http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+func isConnReset(err error) bool {
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+func discard(res *http.Response) {
+	if res != nil && res.Body != nil {
+		_, _ = io.Copy(io.Discard, res.Body)
+		_ = res.Body.Close()
+	}
+}
+
+type attemptCtxKey struct{}
+type attemptInfo struct {
+	n      int
+	reason string // why the previous attempt was retried
+}
+
+// withAttempt records which attempt of Client.Do req is in its context, for the logs
+func withAttempt(req *http.Request, n int, reason string) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), attemptCtxKey{}, attemptInfo{n: n, reason: reason}))
+}
+func attemptFrom(ctx context.Context) (attemptInfo, bool) {
+	a, ok := ctx.Value(attemptCtxKey{}).(attemptInfo)
+	return a, ok
+}
+func retryReason(res *http.Response, err error) string {
+	if err != nil {
+		return err.Error()
+	}
+	if res != nil {
+		return "status " + res.Status
+	}
+	return ""
+}
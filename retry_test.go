@@ -0,0 +1,224 @@
+package httputil_test
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestClient_RetryPolicy(t *testing.T) {
+	var policy = httputil.NewRetryPolicy(2, httputil.RetryDelay(0, 0))
+	t.Run("retry 503 on idempotent method", func(t *testing.T) {
+		var callCtr = atomic.Int32{}
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			if callCtr.Add(1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}).WithRetryPolicy(policy)
+
+		req, err := client.Request(ctx, http.MethodGet, "/", nil, nil)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int32(2), callCtr.Load())
+	})
+	t.Run("no retry of 503 on POST", func(t *testing.T) {
+		var callCtr = atomic.Int32{}
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			callCtr.Add(1)
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}).WithRetryPolicy(policy)
+
+		req, err := client.Request(ctx, http.MethodPost, "/", nil, ReqModel{Name: "Robert"})
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, int32(1), callCtr.Load())
+	})
+	t.Run("retry connection reset", func(t *testing.T) {
+		var (
+			callCtr = atomic.Int32{}
+			hc      = doFunc(func(r *http.Request) (*http.Response, error) {
+				if callCtr.Add(1) == 1 {
+					return nil, fmt.Errorf("read: %w", syscall.ECONNRESET)
+				}
+				return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: http.NoBody}, nil
+			})
+			client = httputil.NewClient().WithLogger(errLogger).
+				WithHttpClient(hc).WithRetryPolicy(policy)
+		)
+		req, err := client.Request(ctx, http.MethodGet, "http://example.com/", nil, nil)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, int32(2), callCtr.Load())
+	})
+	t.Run("deprecated RetriesOn429", func(t *testing.T) {
+		var callCtr = atomic.Int32{}
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			callCtr.Add(1)
+			w.WriteHeader(http.StatusTooManyRequests)
+		}).WithRetryPolicy(nil)
+		client.RetriesOn429 = 1
+
+		req, err := client.Request(ctx, http.MethodGet, "/", nil, nil)
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusTooManyRequests, res.StatusCode)
+		assert.Equal(t, int32(2), callCtr.Load())
+	})
+}
+func TestClient_WithIdempotencyKeys(t *testing.T) {
+	var policy = httputil.NewRetryPolicy(2, httputil.RetryDelay(0, 0))
+	newClient := func(t *testing.T, keys *[]string) httputil.Client {
+		var mu sync.Mutex
+		return clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+			*keys = append(*keys, r.Header.Get(httputil.HeaderIdempotency))
+			if len(*keys) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		}).WithRetryPolicy(policy)
+	}
+	t.Run("same key on every retry", func(t *testing.T) {
+		var (
+			keys   []string
+			buf    bytes.Buffer
+			client = newClient(t, &keys).WithIdempotencyKeys(true).
+				WithLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+		)
+		req, err := client.Request(ctx, http.MethodPost, "/", nil, ReqModel{Name: "Robert"})
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode, "a POST with a key is retried on 503")
+		require.Len(t, keys, 2)
+		assert.NotEmpty(t, keys[0])
+		assert.Equal(t, keys[0], keys[1])
+		assert.Empty(t, req.Header.Get(httputil.HeaderIdempotency), "the callers request is not changed")
+
+		lines := logLines(t, &buf)
+		require.Len(t, lines, 2)
+		assert.Equal(t, keys[0], lines[1]["idempotencyKey"])
+	})
+	t.Run("off by default", func(t *testing.T) {
+		var keys []string
+		client := newClient(t, &keys)
+		req, err := client.Request(ctx, http.MethodPost, "/", nil, ReqModel{Name: "Robert"})
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal(t, []string{""}, keys)
+	})
+	t.Run("GET gets no key", func(t *testing.T) {
+		var keys []string
+		client := newClient(t, &keys).WithIdempotencyKeys(true)
+		req, err := client.Request(ctx, http.MethodGet, "/", nil, nil)
+		require.NoError(t, err)
+		_, err = client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"", ""}, keys)
+	})
+	t.Run("key from the model", func(t *testing.T) {
+		var keys []string
+		client := newClient(t, &keys)
+		_, err := client.DoReq(ctx, http.MethodPost, &orderReq{id: "order-1"}, nil, nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"order-1", "order-1"}, keys)
+	})
+}
+
+type orderReq struct {
+	httputil.ReqHeaders
+	id string
+}
+
+func (r orderReq) Path() httputil.Path    { return httputil.NewPath("/orders") }
+func (r orderReq) Validate() error        { return nil }
+func (r orderReq) IdempotencyKey() string { return r.id }
+func (r orderReq) Body() any              { return map[string]string{"id": r.id} }
+func (r *orderReq) Header() http.Header   { return r.ReqHeaders.Header() }
+
+func TestBackoffPolicy_Retry(t *testing.T) {
+	var (
+		get, _ = http.NewRequest(http.MethodGet, "/", nil)
+		res    = func(status int, h http.Header) *http.Response {
+			return &http.Response{StatusCode: status, Header: h}
+		}
+	)
+	t.Run("max retries", func(t *testing.T) {
+		policy := httputil.NewRetryPolicy(1)
+		_, ok := policy.Retry(1, get, res(http.StatusBadGateway, nil), nil)
+		assert.True(t, ok)
+		_, ok = policy.Retry(2, get, res(http.StatusBadGateway, nil), nil)
+		assert.False(t, ok)
+	})
+	t.Run("backoff is capped", func(t *testing.T) {
+		var (
+			base, maxDelay = 10 * time.Millisecond, 40 * time.Millisecond
+			policy         = httputil.NewRetryPolicy(10, httputil.RetryDelay(base, maxDelay))
+		)
+		for attempt := 1; attempt <= 10; attempt++ {
+			wait, ok := policy.Retry(attempt, get, res(http.StatusGatewayTimeout, nil), nil)
+			require.True(t, ok)
+			assert.LessOrEqual(t, wait, maxDelay)
+			assert.GreaterOrEqual(t, wait, time.Duration(0))
+		}
+	})
+	t.Run("Retry-After seconds", func(t *testing.T) {
+		policy := httputil.NewRetryPolicy(1)
+		wait, ok := policy.Retry(1, get, res(http.StatusTooManyRequests, http.Header{
+			httputil.HeaderRetryAfter: []string{"7"},
+		}), nil)
+		assert.True(t, ok)
+		assert.Equal(t, 7*time.Second, wait)
+	})
+	t.Run("Retry-After http-date", func(t *testing.T) {
+		var (
+			policy = httputil.NewRetryPolicy(1)
+			at     = time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+		)
+		wait, ok := policy.Retry(1, get, res(http.StatusServiceUnavailable, http.Header{
+			httputil.HeaderRetryAfter: []string{at},
+		}), nil)
+		assert.True(t, ok)
+		assert.Greater(t, wait, 28*time.Second)
+		assert.LessOrEqual(t, wait, 30*time.Second)
+	})
+	t.Run("Retry-After too long", func(t *testing.T) {
+		policy := httputil.NewRetryPolicy(1, httputil.RetryMaxRetryAfter(time.Second))
+		_, ok := policy.Retry(1, get, res(http.StatusTooManyRequests, http.Header{
+			httputil.HeaderRetryAfter: []string{"60"},
+		}), nil)
+		assert.False(t, ok)
+	})
+	t.Run("status not in list", func(t *testing.T) {
+		policy := httputil.NewRetryPolicy(1)
+		_, ok := policy.Retry(1, get, res(http.StatusInternalServerError, nil), nil)
+		assert.False(t, ok)
+	})
+}
+
+type doFunc func(r *http.Request) (*http.Response, error)
+
+func (f doFunc) Do(r *http.Request) (*http.Response, error) { return f(r) }
@@ -0,0 +1,261 @@
+package httputil
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderAmzDate          = "X-Amz-Date"
+	HeaderAmzContentSHA256 = "X-Amz-Content-Sha256"
+	HeaderAmzSecurityToken = "X-Amz-Security-Token"
+	UnsignedPayload        = "UNSIGNED-PAYLOAD"
+
+	sigV4Algorithm  = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat = "20060102T150405Z"
+)
+
+var (
+	// sigV4Ignored are never signed, since proxies and the transport may change them
+	sigV4Ignored = []string{"Authorization", "User-Agent", "X-Amzn-Trace-Id", "Expect", "Transfer-Encoding", "Connection"}
+)
+
+type (
+	// AWSCredentials are static credentials, they are also an AWSCredentialsProvider of themselves
+	AWSCredentials struct {
+		AccessKeyID     string
+		SecretAccessKey string
+		SessionToken    string // optional, for temporary credentials
+	}
+	// AWSCredentialsProvider is called for every request so it can rotate temporary credentials
+	AWSCredentialsProvider interface {
+		Credentials(ctx context.Context) (AWSCredentials, error)
+	}
+
+	// SigV4Signer is an Authenticator which signs requests with AWS Signature Version 4
+	// every header which is set when it runs is signed, apart from sigV4Ignored
+	SigV4Signer struct {
+		credentials     AWSCredentialsProvider
+		region          string
+		service         string
+		unsignedPayload bool
+		contentSHA256   bool // send X-Amz-Content-Sha256, always on for s3
+		singleEncode    bool // escape the path once rather than twice, always on for s3
+		normalizePath   bool // remove dot segments and duplicate slashes from the path, always off for s3
+	}
+	SigV4Option = func(*SigV4Signer)
+)
+
+func (c AWSCredentials) Credentials(context.Context) (AWSCredentials, error) { return c, nil }
+
+func NewSigV4Signer(credentials AWSCredentialsProvider, region, service string, options ...SigV4Option) *SigV4Signer {
+	s := &SigV4Signer{
+		credentials:   credentials,
+		region:        region,
+		service:       service,
+		contentSHA256: service == "s3",
+		singleEncode:  service == "s3",
+		normalizePath: service != "s3",
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// SigV4UnsignedPayload signs UNSIGNED-PAYLOAD instead of the hash of the body, so it need not be read
+func SigV4UnsignedPayload() SigV4Option {
+	return func(s *SigV4Signer) { s.unsignedPayload, s.contentSHA256 = true, true }
+}
+
+// SigV4ContentSHA256 sends the payload hash in the X-Amz-Content-Sha256 header, which S3 requires
+func SigV4ContentSHA256() SigV4Option {
+	return func(s *SigV4Signer) { s.contentSHA256 = true }
+}
+
+func (s *SigV4Signer) Authenticate(req *http.Request) error {
+	return s.SignAt(req, time.Now())
+}
+
+// SignAt signs req as if it were sent at t, Authenticate calls it with time.Now
+func (s *SigV4Signer) SignAt(req *http.Request, t time.Time) error {
+	creds, err := s.credentials.Credentials(req.Context())
+	if err != nil {
+		return fmt.Errorf("%s: %w", "aws credentials failed", err)
+	}
+	payloadHash, err := s.payloadHash(req)
+	if err != nil {
+		return err
+	}
+	t = t.UTC()
+	req.Header.Set(HeaderAmzDate, t.Format(sigV4TimeFormat))
+	if creds.SessionToken != "" {
+		req.Header.Set(HeaderAmzSecurityToken, creds.SessionToken)
+	}
+	if s.contentSHA256 {
+		req.Header.Set(HeaderAmzContentSHA256, payloadHash)
+	}
+
+	var (
+		headers, signedHeaders = s.canonicalHeaders(req)
+		canonicalRequest       = strings.Join([]string{
+			req.Method,
+			s.canonicalURI(req.URL),
+			canonicalQuery(req.URL),
+			headers,
+			signedHeaders,
+			payloadHash,
+		}, "\n")
+		date         = t.Format("20060102")
+		scope        = strings.Join([]string{date, s.region, s.service, "aws4_request"}, "/")
+		stringToSign = strings.Join([]string{sigV4Algorithm, t.Format(sigV4TimeFormat), scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+		key          = hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	)
+	for _, v := range []string{s.region, s.service, "aws4_request"} {
+		key = hmacSHA256(key, v)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set(HeaderAuthorization, fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.AccessKeyID, scope, signedHeaders, signature))
+	return nil
+}
+
+// payloadHash hashes a copy of the body from GetBody, or else buffers the body to hash it
+func (s *SigV4Signer) payloadHash(req *http.Request) (string, error) {
+	if s.unsignedPayload {
+		return UnsignedPayload, nil
+	}
+	if req.Body == nil || req.Body == http.NoBody {
+		return sha256Hex(nil), nil
+	}
+	if req.GetBody == nil {
+		body, err := readReqBody(req)
+		if err != nil {
+			return "", err
+		}
+		return sha256Hex(body), nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", "read body failed", err)
+	}
+	defer func() { _ = body.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", fmt.Errorf("%s: %w", "read body failed", err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+func (s *SigV4Signer) canonicalHeaders(req *http.Request) (string, string) {
+	values := map[string]string{"host": requestHost(req)}
+	for k, v := range req.Header {
+		if slices.Contains(sigV4Ignored, http.CanonicalHeaderKey(k)) {
+			continue
+		}
+		trimmed := make([]string, len(v))
+		for i := range v {
+			trimmed[i] = strings.Join(strings.Fields(v[i]), " ")
+		}
+		values[strings.ToLower(k)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	var b strings.Builder
+	for _, k := range names {
+		b.WriteString(k + ":" + values[k] + "\n")
+	}
+	return b.String(), strings.Join(names, ";")
+}
+func (s *SigV4Signer) canonicalURI(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+	if s.singleEncode {
+		path = u.Path
+	}
+	if s.normalizePath {
+		path = normalizePath(path)
+	}
+	segments := strings.Split(path, "/")
+	for i, seg := range segments {
+		segments[i] = sigV4Escape(seg)
+	}
+	return strings.Join(segments, "/")
+}
+
+// normalizePath removes dot segments and duplicate slashes as RFC 3986 does, keeping a trailing slash
+// so "/a/./b/../c//" is "/a/c/"
+func normalizePath(p string) string {
+	clean := path.Clean("/" + p)
+	trailing := strings.HasSuffix(p, "/") || strings.HasSuffix(p, "/.") || strings.HasSuffix(p, "/..")
+	if trailing && clean != "/" {
+		clean += "/"
+	}
+	return clean
+}
+func canonicalQuery(u *url.URL) string {
+	var params [][2]string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(param, "=")
+		k, _ = url.QueryUnescape(k)
+		v, _ = url.QueryUnescape(v)
+		params = append(params, [2]string{sigV4Escape(k), sigV4Escape(v)})
+	}
+	slices.SortFunc(params, func(a, b [2]string) int {
+		if c := strings.Compare(a[0], b[0]); c != 0 {
+			return c
+		}
+		return strings.Compare(a[1], b[1])
+	})
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = p[0] + "=" + p[1]
+	}
+	return strings.Join(pairs, "&")
+}
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// sigV4Escape percent encodes everything but the unreserved characters of RFC 3986
+func sigV4Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+func sha256Hex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
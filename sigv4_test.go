@@ -0,0 +1,205 @@
+package httputil_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+// vectors from the AWS SigV4 test suite, all signed at 20150830T123600Z
+// get-space and get-utf8 are left out, their raw paths are always escaped by net/url
+// and so escaped twice for a service other than s3
+func TestSigV4Signer_testSuite(t *testing.T) {
+	var (
+		creds  = httputil.AWSCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+		signer = httputil.NewSigV4Signer(creds, "us-east-1", "service")
+		at     = time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	)
+	var tests = map[string]struct {
+		method, uri, body string
+		header            http.Header
+		signedHeaders     string
+		signature         string
+	}{
+		"get-vanilla": {
+			method:        http.MethodGet,
+			uri:           "/",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		"post-vanilla": {
+			method:        http.MethodPost,
+			uri:           "/",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		"get-vanilla-query-order-key-case": {
+			method:        http.MethodGet,
+			uri:           "/?Param2=value2&Param1=value1",
+			signedHeaders: "host;x-amz-date",
+			signature:     "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		"get-relative": {
+			method:        http.MethodGet,
+			uri:           "/example/..",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		"get-relative-relative": {
+			method:        http.MethodGet,
+			uri:           "/example1/example2/../..",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		"get-slash": {
+			method:        http.MethodGet,
+			uri:           "//",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		"get-slash-dot-slash": {
+			method:        http.MethodGet,
+			uri:           "/./",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		"get-slash-pointless-dot": {
+			method:        http.MethodGet,
+			uri:           "/./example",
+			signedHeaders: "host;x-amz-date",
+			signature:     "ef75d96142cf21edca26f06005da7988e4f8dc83a165a80865db7089db637ec5",
+		},
+		"get-slashes": {
+			method:        http.MethodGet,
+			uri:           "//example//",
+			signedHeaders: "host;x-amz-date",
+			signature:     "9a624bd73a37c9a373b5312afbebe7a714a789de108f0bdfe846570885f57e84",
+		},
+		"get-unreserved": {
+			method:        http.MethodGet,
+			uri:           "/-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+			signedHeaders: "host;x-amz-date",
+			signature:     "07ef7494c76fa4850883e2b006601f940f8a34d404d0cfa977f52a65bbf5f24f",
+		},
+		"get-vanilla-empty-query-key": {
+			method:        http.MethodGet,
+			uri:           "/?Param1=value1",
+			signedHeaders: "host;x-amz-date",
+			signature:     "a67d582fa61cc504c4bae71f336f98b97f1ea3c7a6bfe1b6e45aec72011b9aeb",
+		},
+		"get-vanilla-query-unreserved": {
+			method:        http.MethodGet,
+			uri:           "/?-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz=-._~0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+			signedHeaders: "host;x-amz-date",
+			signature:     "9c3e54bfcdf0b19771a7f523ee5669cdf59bc7cc0884027167c21bb143a40197",
+		},
+		"get-vanilla-utf8-query": {
+			method:        http.MethodGet,
+			uri:           "/?ሴ=bar",
+			signedHeaders: "host;x-amz-date",
+			signature:     "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04",
+		},
+		"get-header-key-duplicate": {
+			method:        http.MethodGet,
+			uri:           "/",
+			header:        http.Header{"My-Header1": {"value2", "value2", "value1"}},
+			signedHeaders: "host;my-header1;x-amz-date",
+			signature:     "c9d5ea9f3f72853aea855b47ea873832890dbdd183b4468f858259531a5138ea",
+		},
+		"get-header-value-order": {
+			method:        http.MethodGet,
+			uri:           "/",
+			header:        http.Header{"My-Header1": {"value4", "value1", "value3", "value2"}},
+			signedHeaders: "host;my-header1;x-amz-date",
+			signature:     "08c7e5a9acfcfeb3ab6b2185e75ce8b1deb5e634ec47601a50643f830c755c01",
+		},
+		"get-header-value-trim": {
+			method:        http.MethodGet,
+			uri:           "/",
+			header:        http.Header{"My-Header1": {" value1"}, "My-Header2": {` "a   b   c"`}},
+			signedHeaders: "host;my-header1;my-header2;x-amz-date",
+			signature:     "acc3ed3afb60bb290fc8d2dd0098b9911fcaa05412b367055dee359757a9c736",
+		},
+		"post-x-www-form-urlencoded": {
+			method:        http.MethodPost,
+			uri:           "/",
+			body:          "Param1=value1",
+			header:        http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			signedHeaders: "content-type;host;x-amz-date",
+			signature:     "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, "https://example.amazonaws.com"+tc.uri, strings.NewReader(tc.body))
+			require.NoError(t, err)
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			require.NoError(t, signer.SignAt(req, at))
+			assert.Equal(t, "20150830T123600Z", req.Header.Get(httputil.HeaderAmzDate))
+			assert.Equal(t,
+				"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, "+
+					"SignedHeaders="+tc.signedHeaders+", Signature="+tc.signature,
+				req.Header.Get(httputil.HeaderAuthorization))
+		})
+	}
+}
+func TestSigV4Signer(t *testing.T) {
+	creds := httputil.AWSCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret", SessionToken: "session"}
+	t.Run("client", func(t *testing.T) {
+		var body []byte
+		client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Contains(t, r.Header.Get(httputil.HeaderAuthorization), "Credential=AKID/")
+			assert.Contains(t, r.Header.Get(httputil.HeaderAuthorization), "x-amz-content-sha256;x-amz-date;x-amz-security-token")
+			assert.Equal(t, "session", r.Header.Get(httputil.HeaderAmzSecurityToken))
+			assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", r.Header.Get(httputil.HeaderAmzContentSHA256))
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusOK)
+		}).WithAuth(httputil.NewSigV4Signer(creds, "us-east-1", "s3"))
+
+		req, err := client.Request(ctx, http.MethodPut, "/bucket/key", nil, strings.NewReader("hello"))
+		require.NoError(t, err)
+		res, err := client.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, "hello", string(body), "the body is still sent after it was hashed")
+	})
+	t.Run("unsigned payload", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, "https://example.com/a", strings.NewReader("hello"))
+		require.NoError(t, err)
+		require.NoError(t, httputil.NewSigV4Signer(creds, "us-east-1", "execute-api", httputil.SigV4UnsignedPayload()).Authenticate(req))
+		assert.Equal(t, httputil.UnsignedPayload, req.Header.Get(httputil.HeaderAmzContentSHA256))
+	})
+	t.Run("s3 path as is", func(t *testing.T) {
+		signature := func(service, uri string) string {
+			req, err := http.NewRequest(http.MethodGet, "https://example.com"+uri, nil)
+			require.NoError(t, err)
+			require.NoError(t, httputil.NewSigV4Signer(creds, "us-east-1", service).SignAt(req, time.Unix(0, 0)))
+			return req.Header.Get(httputil.HeaderAuthorization)
+		}
+		assert.Equal(t, signature("execute-api", "/a/b"), signature("execute-api", "/a/./c/..//b"))
+		assert.NotEqual(t, signature("s3", "/a/b"), signature("s3", "/a//b"))
+	})
+	t.Run("credentials provider", func(t *testing.T) {
+		fail := errors.New("expired")
+		req, err := http.NewRequest(http.MethodGet, "https://example.com/a", nil)
+		require.NoError(t, err)
+		err = httputil.NewSigV4Signer(credsFunc(func(context.Context) (httputil.AWSCredentials, error) {
+			return httputil.AWSCredentials{}, fail
+		}), "us-east-1", "execute-api").Authenticate(req)
+		assert.ErrorIs(t, err, fail)
+	})
+}
+
+type credsFunc func(ctx context.Context) (httputil.AWSCredentials, error)
+
+func (f credsFunc) Credentials(ctx context.Context) (httputil.AWSCredentials, error) { return f(ctx) }
@@ -0,0 +1,320 @@
+package httputil
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"reflect"
+	"sync"
+	"unicode/utf8"
+)
+
+type (
+	// Interaction is one line of a JSONL cassette, a request and the response it got
+	Interaction struct {
+		Request  RecordedRequest  `json:"request"`
+		Response RecordedResponse `json:"response"`
+	}
+	RecordedRequest struct {
+		Method string      `json:"method"`
+		URL    string      `json:"url"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body,omitempty"`
+		Base64 bool        `json:"base64,omitempty"` // the body is not utf8 so it is base64 encoded
+	}
+	RecordedResponse struct {
+		Status int         `json:"status"`
+		Header http.Header `json:"header,omitempty"`
+		Body   string      `json:"body,omitempty"`
+		Base64 bool        `json:"base64,omitempty"`
+	}
+
+	// Recorder is an httpClient which sends requests using HttpClient
+	// and appends every request and response pair to a JSONL cassette
+	// the url, headers and bodies are recorded with the Redaction applied, so the defaults are always masked
+	// and the cassette can be committed, replay it with ReplayRedaction set to the same Redaction
+	Recorder struct {
+		HttpClient httpClient
+		Redaction  Redaction
+		path       string
+		mu         sync.Mutex
+	}
+
+	// Replayer is an httpClient which serves the responses of a cassette without any network calls
+	// a request gets the response of the first interaction it matches, see ReplayMatch
+	// in strict mode, the default, interactions are served in the order they were recorded and only once
+	// in lenient mode any matching interaction is served, unused ones before those used already
+	Replayer struct {
+		interactions []Interaction
+		used         []bool
+		match        Match
+		lenient      bool
+		redaction    Redaction
+		mu           sync.Mutex
+	}
+	ReplayOption = func(*Replayer)
+
+	// Match is a set of the parts of a request which must be equal to the recorded one
+	Match int
+)
+
+const (
+	MatchMethod Match = 1 << iota
+	MatchPath
+	MatchQuery
+	MatchBody // JSON bodies are compared by value so key order and spacing do not matter
+	MatchHost
+
+	DefaultMatch = MatchMethod | MatchPath | MatchQuery | MatchBody
+)
+
+var (
+	ErrNoInteraction = errors.New("no matching interaction in cassette")
+)
+
+// NewRecorder appends to the cassette at path, use NewReplayer to read it back
+func NewRecorder(path string, hc httpClient) *Recorder {
+	return &Recorder{HttpClient: hc, path: path}
+}
+func (r *Recorder) Do(req *http.Request) (*http.Response, error) {
+	reqBody, err := readReqBody(req)
+	if err != nil {
+		return nil, err
+	}
+	hc := r.HttpClient
+	if hc == nil {
+		hc = defaultClient
+	}
+	res, err := hc.Do(req)
+	if err != nil {
+		return res, err
+	}
+	resBody, err := io.ReadAll(res.Body)
+	_ = res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(resBody))
+	if err != nil {
+		return res, fmt.Errorf("%s: %w", "read response body failed", err)
+	}
+
+	rec := Interaction{
+		Request: RecordedRequest{
+			Method: req.Method,
+			URL:    r.Redaction.url(req.URL.String()),
+			Header: r.Redaction.header(req.Header),
+		},
+		Response: RecordedResponse{
+			Status: res.StatusCode,
+			Header: r.Redaction.header(res.Header),
+		},
+	}
+	rec.Request.Body, rec.Request.Base64 = encodeRecordedBody(r.Redaction.bodyBytes(req.Header, reqBody))
+	rec.Response.Body, rec.Response.Base64 = encodeRecordedBody(r.Redaction.bodyBytes(res.Header, resBody))
+	if err := r.append(rec); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+func (r *Recorder) append(rec Interaction) error {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("%s: %w", "encode interaction failed", err)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("%s: %w", "open cassette failed", err)
+	}
+	_, err = f.Write(append(line, '\n'))
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", "write cassette failed", err)
+	}
+	return nil
+}
+
+// NewReplayer loads the cassette at path
+func NewReplayer(path string, options ...ReplayOption) (*Replayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "open cassette failed", err)
+	}
+	defer func() { _ = f.Close() }()
+	r := &Replayer{match: DefaultMatch}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 64<<20)
+	for n := 1; scanner.Scan(); n++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var rec Interaction
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", "decode cassette failed", n, err)
+		}
+		r.interactions = append(r.interactions, rec)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", "read cassette failed", err)
+	}
+	r.used = make([]bool, len(r.interactions))
+	for _, option := range options {
+		option(r)
+	}
+	return r, nil
+}
+
+// ReplayMatch sets which parts of a request must match, DefaultMatch by default
+func ReplayMatch(m Match) ReplayOption {
+	return func(r *Replayer) { r.match = m }
+}
+
+// ReplayLenient lets requests be served in any order and interactions be served more than once
+func ReplayLenient() ReplayOption {
+	return func(r *Replayer) { r.lenient = true }
+}
+
+// ReplayRedaction is the Redaction of the Recorder, requests are masked with it before they are matched
+// the defaults are always masked, so it is only needed when the Recorder masked more
+func ReplayRedaction(redaction Redaction) ReplayOption {
+	return func(r *Replayer) { r.redaction = redaction }
+}
+func (r *Replayer) Do(req *http.Request) (*http.Response, error) {
+	body, err := readReqBody(req)
+	if err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	i, ok := r.find(req, body)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoInteraction, req.Method, req.URL)
+	}
+	r.used[i] = true
+	return r.interactions[i].Response.response(req)
+}
+
+// Unused returns the interactions which were not served, to check a test made every call it recorded
+func (r *Replayer) Unused() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var unused []Interaction
+	for i, rec := range r.interactions {
+		if !r.used[i] {
+			unused = append(unused, rec)
+		}
+	}
+	return unused
+}
+func (r *Replayer) find(req *http.Request, body []byte) (int, bool) {
+	if !r.lenient {
+		// the next unused one must match
+		for i := range r.interactions {
+			if !r.used[i] {
+				return i, r.matches(req, body, r.interactions[i].Request)
+			}
+		}
+		return 0, false
+	}
+	found := -1
+	for i, rec := range r.interactions {
+		if !r.matches(req, body, rec.Request) {
+			continue
+		}
+		if !r.used[i] {
+			return i, true
+		}
+		if found < 0 {
+			found = i
+		}
+	}
+	return found, found >= 0
+}
+func (r *Replayer) matches(req *http.Request, body []byte, rec RecordedRequest) bool {
+	u, err := url.Parse(rec.URL)
+	if err != nil {
+		return false
+	}
+	switch {
+	case r.match&MatchMethod != 0 && req.Method != rec.Method,
+		r.match&MatchHost != 0 && req.URL.Host != u.Host,
+		r.match&MatchPath != 0 && req.URL.Path != u.Path,
+		r.match&MatchQuery != 0 && !r.queryMatches(req.URL.RawQuery, u.Query()):
+		return false
+	}
+	if r.match&MatchBody == 0 {
+		return true
+	}
+	recBody, err := decodeRecordedBody(rec.Body, rec.Base64)
+	return err == nil && bodiesEqual(r.redaction.bodyBytes(req.Header, body), recBody)
+}
+func (r *Replayer) queryMatches(rawQuery string, recorded url.Values) bool {
+	query, err := url.ParseQuery(r.redaction.query(rawQuery))
+	return err == nil && reflect.DeepEqual(query, recorded)
+}
+
+func (rec RecordedResponse) response(req *http.Request) (*http.Response, error) {
+	body, err := decodeRecordedBody(rec.Body, rec.Base64)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "decode recorded body failed", err)
+	}
+	header := rec.Header.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", rec.Status, http.StatusText(rec.Status)),
+		StatusCode:    rec.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// readReqBody reads the body of req and replaces it so it can still be sent
+func readReqBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+	b, err := io.ReadAll(req.Body)
+	_ = req.Body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "read body failed", err)
+	}
+	req.Body = io.NopCloser(bytes.NewReader(b))
+	return b, nil
+}
+func encodeRecordedBody(b []byte) (string, bool) {
+	if utf8.Valid(b) {
+		return string(b), false
+	}
+	return base64.StdEncoding.EncodeToString(b), true
+}
+func decodeRecordedBody(s string, isBase64 bool) ([]byte, error) {
+	if isBase64 {
+		return base64.StdEncoding.DecodeString(s)
+	}
+	return []byte(s), nil
+}
+func bodiesEqual(a, b []byte) bool {
+	if bytes.Equal(a, b) {
+		return true
+	}
+	var va, vb any
+	if json.Unmarshal(a, &va) != nil || json.Unmarshal(b, &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va, vb)
+}
@@ -0,0 +1,140 @@
+package httputil_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/tempcke/httputil"
+)
+
+func TestRecorderReplayer(t *testing.T) {
+	var (
+		cassette = filepath.Join(t.TempDir(), "cassette.jsonl")
+		host     string
+	)
+	call := func(t *testing.T, client httputil.Client, method, uri string, in any) (ResModel, error) {
+		t.Helper()
+		req, err := client.Request(ctx, method, uri, nil, in)
+		require.NoError(t, err)
+		var out ResModel
+		_, err = client.DoAndDecode(req, &out, nil)
+		return out, err
+	}
+
+	// record against a server
+	client := clientWithFakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var in ReqModel
+		_ = json.NewDecoder(r.Body).Decode(&in)
+		writeJSON(w, ResModel{ID: r.URL.Query().Get("id"), Name: in.Name})
+	}).WithSetHeader("Authorization", "Bearer s3cr3t")
+	host = client.Host
+	client = client.WithHttpClient(httputil.NewRecorder(cassette, http.DefaultClient))
+	_, err := call(t, client, http.MethodGet, "/ref?id=1", nil)
+	require.NoError(t, err)
+	_, err = call(t, client, http.MethodPost, "/ref?id=2", ReqModel{Name: "Robert"})
+	require.NoError(t, err)
+
+	b, err := os.ReadFile(cassette)
+	require.NoError(t, err)
+	assert.Len(t, strings.Split(strings.TrimSpace(string(b)), "\n"), 2)
+	assert.NotContains(t, string(b), "s3cr3t")
+
+	replay := func(t *testing.T, options ...httputil.ReplayOption) (httputil.Client, *httputil.Replayer) {
+		replayer, err := httputil.NewReplayer(cassette, options...)
+		require.NoError(t, err)
+		return httputil.NewClient().WithHost(host).WithLogger(errLogger).WithHttpClient(replayer), replayer
+	}
+	t.Run("strict", func(t *testing.T) {
+		client, replayer := replay(t)
+		out, err := call(t, client, http.MethodGet, "/ref?id=1", nil)
+		require.NoError(t, err)
+		assert.Equal(t, ResModel{ID: "1"}, out)
+		assert.Len(t, replayer.Unused(), 1)
+
+		_, err = call(t, client, http.MethodPost, "/ref?id=2", ReqModel{Name: "Bob"})
+		assert.ErrorIs(t, err, httputil.ErrNoInteraction, "body does not match")
+		out, err = call(t, client, http.MethodPost, "/ref?id=2", ReqModel{Name: "Robert"})
+		require.NoError(t, err)
+		assert.Equal(t, ResModel{ID: "2", Name: "Robert"}, out)
+		assert.Empty(t, replayer.Unused())
+
+		_, err = call(t, client, http.MethodGet, "/ref?id=1", nil)
+		assert.ErrorIs(t, err, httputil.ErrNoInteraction, "each one is served once")
+	})
+	t.Run("strict order", func(t *testing.T) {
+		client, _ := replay(t)
+		_, err := call(t, client, http.MethodPost, "/ref?id=2", ReqModel{Name: "Robert"})
+		assert.ErrorIs(t, err, httputil.ErrNoInteraction)
+	})
+	t.Run("lenient", func(t *testing.T) {
+		client, _ := replay(t, httputil.ReplayLenient(), httputil.ReplayMatch(httputil.MatchMethod|httputil.MatchPath))
+		out, err := call(t, client, http.MethodPost, "/ref?id=3", ReqModel{Name: "Bob"})
+		require.NoError(t, err)
+		assert.Equal(t, ResModel{ID: "2", Name: "Robert"}, out)
+		for i := 0; i < 2; i++ {
+			out, err = call(t, client, http.MethodGet, "/ref", nil)
+			require.NoError(t, err)
+			assert.Equal(t, "1", out.ID)
+		}
+	})
+	t.Run("response", func(t *testing.T) {
+		replayer, err := httputil.NewReplayer(cassette)
+		require.NoError(t, err)
+		req, err := http.NewRequest(http.MethodGet, host+"/ref?id=1", nil)
+		require.NoError(t, err)
+		res, err := replayer.Do(req)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Equal(t, httputil.ApplicationJSON, res.Header.Get(httputil.HeaderContentType))
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"id":"1","name":""}`, string(body))
+	})
+}
+func TestRecorder_redaction(t *testing.T) {
+	var (
+		cassette = filepath.Join(t.TempDir(), "cassette.jsonl")
+		secrets  = []string{"CLIENTSECRET", "QSECRET", "COOKIESECRET", "TOKENSECRET", "REFRESHSECRET"}
+		form     = url.Values{"grant_type": {"client_credentials"}, "client_secret": {"CLIENTSECRET"}}.Encode()
+	)
+	server := fakeServer(t, func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "sid", Value: "COOKIESECRET"})
+		writeJSON(w, map[string]any{"access_token": "TOKENSECRET", "refresh_token": "REFRESHSECRET", "expires_in": 3600})
+	})
+	exchange := func(t *testing.T, hc interface {
+		Do(*http.Request) (*http.Response, error)
+	}) map[string]any {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/oauth/token?api_key=QSECRET", strings.NewReader(form))
+		require.NoError(t, err)
+		req.Header.Set(httputil.HeaderContentType, httputil.ApplicationForm)
+		res, err := hc.Do(req)
+		require.NoError(t, err)
+		var out map[string]any
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&out))
+		return out
+	}
+
+	out := exchange(t, httputil.NewRecorder(cassette, http.DefaultClient))
+	assert.Equal(t, "TOKENSECRET", out["access_token"], "the caller still gets the real response")
+
+	b, err := os.ReadFile(cassette)
+	require.NoError(t, err)
+	for _, secret := range secrets {
+		assert.NotContains(t, string(b), secret)
+	}
+	assert.Contains(t, string(b), "grant_type=client_credentials")
+	assert.Contains(t, string(b), "expires_in")
+
+	replayer, err := httputil.NewReplayer(cassette)
+	require.NoError(t, err)
+	out = exchange(t, replayer)
+	assert.Equal(t, httputil.Redacted, out["access_token"], "the masked request still matches")
+}